@@ -0,0 +1,269 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mr-tron/base58"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// Network holds the address encoding parameters of a bitcoin network.
+type Network struct {
+	Name string
+
+	// PubKeyHashPrefix and ScriptHashPrefix are the version bytes of
+	// Base58Check encoded P2PKH and P2SH addresses.
+	PubKeyHashPrefix byte
+	ScriptHashPrefix byte
+
+	// Bech32HRP is the human readable part of segwit addresses.
+	Bech32HRP string
+}
+
+var (
+	MainNet = &Network{Name: "main", PubKeyHashPrefix: 0x00, ScriptHashPrefix: 0x05, Bech32HRP: "bc"}
+	TestNet = &Network{Name: "test", PubKeyHashPrefix: 0x6f, ScriptHashPrefix: 0xc4, Bech32HRP: "tb"}
+	SigNet  = &Network{Name: "signet", PubKeyHashPrefix: 0x6f, ScriptHashPrefix: 0xc4, Bech32HRP: "tb"}
+	RegTest = &Network{Name: "regtest", PubKeyHashPrefix: 0x6f, ScriptHashPrefix: 0xc4, Bech32HRP: "bcrt"}
+)
+
+// Address returns the address paid to by the output script on the given
+// network. Only P2PKH, P2SH and segwit outputs have addresses; other
+// scripts return ErrNoAddress.
+func (s Script) Address(net *Network) (string, error) {
+	switch s.Class() {
+	case P2PKH:
+		return base58CheckEncode(net.PubKeyHashPrefix, s[3:23]), nil
+	case P2SH:
+		return base58CheckEncode(net.ScriptHashPrefix, s[2:22]), nil
+	case P2WPKH, P2WSH, P2TR, WitnessUnknown:
+		version, program, _ := s.WitnessProgram()
+		return segwitAddress(net.Bech32HRP, version, program)
+	default:
+		return "", fmt.Errorf("%w: %s script", ErrNoAddress, s.Class())
+	}
+}
+
+// AddressScript returns the output script paying to a P2PKH, P2SH or
+// segwit address of the given network. It is the inverse of Address; other
+// strings, and addresses of other networks, return ErrInvalidAddress.
+func AddressScript(addr string, net *Network) (Script, error) {
+	if strings.HasPrefix(strings.ToLower(addr), net.Bech32HRP+"1") {
+		version, program, err := decodeSegwitAddress(net.Bech32HRP, addr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAddress, err)
+		}
+		return witnessProgramScript(version, program), nil
+	}
+
+	version, payload, err := base58CheckDecode(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAddress, err)
+	}
+	if len(payload) != 20 {
+		return nil, fmt.Errorf("%w: payload of %d bytes", ErrInvalidAddress, len(payload))
+	}
+
+	switch version {
+	case net.PubKeyHashPrefix:
+		return pubKeyHashScript(payload), nil
+	case net.ScriptHashPrefix:
+		return scriptHashScript(payload), nil
+	default:
+		return nil, fmt.Errorf("%w: version %#x on %s network", ErrInvalidAddress, version, net.Name)
+	}
+}
+
+func pubKeyHashScript(hash []byte) Script {
+	s := Script{byte(OpDup), byte(OpHash160), 20}
+	s = append(s, hash...)
+	return append(s, byte(OpEqualVerify), byte(OpCheckSig))
+}
+
+func scriptHashScript(hash []byte) Script {
+	s := Script{byte(OpHash160), 20}
+	s = append(s, hash...)
+	return append(s, byte(OpEqual))
+}
+
+func witnessProgramScript(version int, program []byte) Script {
+	s := Script{byte(OpFalse)}
+	if version > 0 {
+		s[0] = byte(OpTrue) + byte(version-1)
+	}
+	s = append(s, byte(len(program)))
+	return append(s, program...)
+}
+
+func base58CheckEncode(version byte, payload []byte) string {
+	data := append([]byte{version}, payload...)
+	sum, _ := mh.Sum(data, mh.DBL_SHA2_256, -1)
+	return base58.Encode(append(data, sum[2:6]...))
+}
+
+func base58CheckDecode(s string) (byte, []byte, error) {
+	data, err := base58.Decode(s)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < 5 {
+		return 0, nil, fmt.Errorf("too short")
+	}
+
+	payload, checksum := data[:len(data)-4], data[len(data)-4:]
+	sum, _ := mh.Sum(payload, mh.DBL_SHA2_256, -1)
+	if !bytes.Equal(sum[2:6], checksum) {
+		return 0, nil, fmt.Errorf("bad checksum")
+	}
+	return payload[0], payload[1:], nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+// segwitAddress encodes a witness program as a BIP173 bech32 address for
+// version 0, or a BIP350 bech32m address for later versions.
+func segwitAddress(hrp string, version int, program []byte) (string, error) {
+	if version > 16 || len(program) < 2 || len(program) > 40 {
+		return "", fmt.Errorf("invalid witness program")
+	}
+
+	data := []byte{byte(version)}
+	conv, _ := convertBits(program, 8, 5, true)
+	data = append(data, conv...)
+
+	checksum := uint32(bech32Const)
+	if version > 0 {
+		checksum = bech32mConst
+	}
+
+	values := append(bech32HRPExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ checksum
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+
+	return sb.String(), nil
+}
+
+// decodeSegwitAddress decodes a BIP173 or BIP350 address with the human
+// readable part hrp, requiring the checksum variant matching its witness
+// version.
+func decodeSegwitAddress(hrp, addr string) (int, []byte, error) {
+	if len(addr) > 90 {
+		return 0, nil, fmt.Errorf("too long")
+	}
+
+	lower := strings.ToLower(addr)
+	if lower != addr && strings.ToUpper(addr) != addr {
+		return 0, nil, fmt.Errorf("mixed case")
+	}
+
+	sep := strings.LastIndexByte(lower, '1')
+	if lower[:sep] != hrp {
+		return 0, nil, fmt.Errorf("wrong human readable part")
+	}
+
+	var data []byte
+	for _, c := range []byte(lower[sep+1:]) {
+		d := strings.IndexByte(bech32Charset, c)
+		if d < 0 {
+			return 0, nil, fmt.Errorf("invalid character %q", c)
+		}
+		data = append(data, byte(d))
+	}
+	if len(data) < 7 {
+		return 0, nil, fmt.Errorf("too short")
+	}
+
+	version := int(data[0])
+	checksum := uint32(bech32Const)
+	if version > 0 {
+		checksum = bech32mConst
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), data...)) != checksum {
+		return 0, nil, fmt.Errorf("bad checksum")
+	}
+
+	program, ok := convertBits(data[1:len(data)-6], 5, 8, false)
+	if !ok {
+		return 0, nil, fmt.Errorf("invalid padding")
+	}
+	if version > 16 || len(program) < 2 || len(program) > 40 {
+		return 0, nil, fmt.Errorf("invalid witness program")
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return 0, nil, fmt.Errorf("invalid witness v0 program length %d", len(program))
+	}
+
+	return version, program, nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// convertBits regroups data from groups of from bits into groups of to
+// bits. With pad, the last group is padded with zeroes; without, leftover
+// bits must be zero padding of less than a group, or ok is false.
+func convertBits(data []byte, from, to uint, pad bool) (out []byte, ok bool) {
+	var acc uint32
+	var bits uint
+	for _, b := range data {
+		if b>>from != 0 {
+			return nil, false
+		}
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits)&(1<<to-1))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits))&(1<<to-1))
+		}
+	} else if bits >= from || byte(acc<<(to-bits))&(1<<to-1) != 0 {
+		return nil, false
+	}
+	return out, true
+}
@@ -0,0 +1,276 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+)
+
+func TestScriptClassAddress(t *testing.T) {
+	for _, c := range []struct {
+		script  string
+		class   string
+		net     *Network
+		address string
+	}{
+		{"76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac", "pubkeyhash", MainNet, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		{"a914e8c300c87986efa84c37c0519929019ef86eb5b487", "scripthash", MainNet, "3NukJ6fYZJ5Kk8bPjycAnruZkE5Q7UW7i8"},
+		{"a914c579342c2c4c9220205e2cdc285617040c924a0a87", "scripthash", TestNet, "2NBFNJTktNa7GZusGbDbGKRZTxdK9VVez3n"},
+		{"0014751e76e8199196d454941c45d1b3a323f1433bd6", "witness_v0_keyhash", MainNet, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{"0014751e76e8199196d454941c45d1b3a323f1433bd6", "witness_v0_keyhash", TestNet, "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"},
+		{"00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", "witness_v0_scripthash", MainNet, "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3"},
+		{"00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", "witness_v0_scripthash", SigNet, "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7"},
+		{"512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", "witness_v1_taproot", MainNet, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+		{"5210751e76e8199196d454941c45d1b3a323", "witness_unknown", MainNet, "bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs"},
+		{"6002751e", "witness_unknown", MainNet, "bc1sw50qgdz25j"},
+		{"4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac", "pubkey", MainNet, ""},
+		{"2103a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bdac", "pubkey", MainNet, ""},
+		{"4c2103a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bdac", "nonstandard", MainNet, ""},
+		{"512103a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd51ae", "multisig", MainNet, ""},
+		{"6a0b68656c6c6f20776f726c64", "nulldata", MainNet, ""},
+		{"6a", "nulldata", MainNet, ""},
+		{"6a76", "nonstandard", MainNet, ""},
+		{"0015751e76e8199196d454941c45d1b3a323f1433bd6aa", "nonstandard", MainNet, ""},
+		{"522103a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd51ae", "nonstandard", MainNet, ""},
+	} {
+		raw, err := hex.DecodeString(c.script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := Script(raw)
+
+		if class := s.Class().String(); class != c.class {
+			t.Fatalf("%s: expected class %s, got %s", c.script, c.class, class)
+		}
+
+		addr, err := s.Address(c.net)
+		if c.address == "" {
+			if !errors.Is(err, ErrNoAddress) {
+				t.Fatalf("%s: expected ErrNoAddress, got %q, %v", c.script, addr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", c.script, err)
+		}
+		if addr != c.address {
+			t.Fatalf("%s: expected address %s, got %s", c.script, c.address, addr)
+		}
+
+		back, err := AddressScript(addr, c.net)
+		if err != nil {
+			t.Fatalf("%s: %s", addr, err)
+		}
+		if !bytes.Equal(back, s) {
+			t.Fatalf("%s: expected script %s, got %x", addr, c.script, []byte(back))
+		}
+	}
+}
+
+func TestAddressScript(t *testing.T) {
+	script, err := AddressScript("BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", MainNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(script) != "0014751e76e8199196d454941c45d1b3a323f1433bd6" {
+		t.Fatalf("unexpected script %x", []byte(script))
+	}
+
+	// invalid addresses of BIP173 and BIP350
+	for _, c := range []struct {
+		addr string
+		net  *Network
+	}{
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", MainNet},
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", TestNet},
+		{"2NBFNJTktNa7GZusGbDbGKRZTxdK9VVez3n", MainNet},
+		{"not an address", MainNet},
+		{"tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut", MainNet},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", MainNet},
+		{"tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf", TestNet},
+		{"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL", MainNet},
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", MainNet},
+		{"tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47", TestNet},
+		{"bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4", MainNet},
+		{"BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R", MainNet},
+		{"bc1pw5dgrnzv", MainNet},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v8n0nx0muaewav253zgeav", MainNet},
+		{"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P", MainNet},
+		{"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47Zagq", TestNet},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v07qwwzcrf", MainNet},
+		{"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vpggkg4j", TestNet},
+		{"bc1gmk9yu", MainNet},
+		{"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", MainNet},
+	} {
+		if script, err := AddressScript(c.addr, c.net); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("%s: expected ErrInvalidAddress, got %x, %v", c.addr, []byte(script), err)
+		}
+	}
+}
+
+func TestResolveAddress(t *testing.T) {
+	data, err := hex.DecodeString(txdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := DecodeTx(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	typ, _, err := tx.Resolve([]string{"outputs", "0", "type"})
+	if err != nil || typ != "pubkeyhash" {
+		t.Fatalf("expected pubkeyhash, got %v, %v", typ, err)
+	}
+
+	addr, _, err := tx.Resolve([]string{"outputs", "0", "address"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "1KFHE7w8BhaENAswwryaoccDb6qcT6DbYY" {
+		t.Fatalf("unexpected address %v", addr)
+	}
+
+	tx.Network = TestNet
+	addr, _, err = tx.Resolve([]string{"outputs", "0", "address"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "mymEXB26zj1V9HMZfRwxdXpYT6SKNTtB33" {
+		t.Fatalf("unexpected testnet address %v", addr)
+	}
+
+	data = loadFixture(t, "block.hex")
+	nodes, err := DecodeBlockMessage(data, AddressNetwork(RegTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodes[1].(*Tx).Network != RegTest {
+		t.Fatal("expected decoded transactions to use the network given")
+	}
+
+	// the option reaches the other decoders too
+	b, err := blocks.NewBlockWithCid(nodes[1].RawData(), nodes[1].Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg node.Registry
+	RegisterDecoders(&reg, AddressNetwork(RegTest))
+	for _, decode := range []node.DecodeBlockFunc{NewNodeDecoder(AddressNetwork(RegTest)), reg.Decode} {
+		n, err := decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.(*Tx).Network != RegTest {
+			t.Fatal("expected node decoders to use the network given")
+		}
+	}
+	if n, err := DecodeNode(b); err != nil || n.(*Tx).Network != nil {
+		t.Fatalf("expected DecodeNode to leave the network unset, got %v", err)
+	}
+
+	err = NewBlockStreamDecoder(bytes.NewReader(data), AddressNetwork(RegTest)).Decode(context.Background(), func(n node.Node) error {
+		if tx, ok := n.(*Tx); ok && tx.Network != RegTest {
+			t.Fatal("expected the stream decoder to use the network given")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// blk*.dat files record the network in the magic of each block
+	var file bytes.Buffer
+	file.Write([]byte{0x0b, 0x11, 0x09, 0x07})
+	binary.Write(&file, binary.LittleEndian, uint32(len(data)))
+	file.Write(data)
+	fb, err := NewBlkFileReader(&file, nil).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fb.Txs[0].Tx.Network != TestNet {
+		t.Fatal("expected testnet transactions in a testnet block file")
+	}
+}
+
+func TestOpReturnCid(t *testing.T) {
+	data, err := hex.DecodeString(txdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := DecodeTx(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v0, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := tx.Cid()
+
+	nulldata := func(pushes ...[]byte) *TxOut {
+		s := []byte{byte(OpReturn)}
+		for _, p := range pushes {
+			s = append(s, byte(len(p)))
+			s = append(s, p...)
+		}
+		return &TxOut{Script: s}
+	}
+
+	tx.Outputs = append(tx.Outputs,
+		nulldata(v0.Bytes()),
+		nulldata([]byte("hello"), []byte(v1.String())),
+		nulldata(append([]byte{0}, v1.Bytes()...)),
+		nulldata([]byte("not a cid")),
+		&TxOut{Script: append([]byte{byte(OpReturn), 36, 0xaa, 0x21, 0xa9, 0xed}, make([]byte, 32)...)},
+	)
+
+	expected := map[string]cid.Cid{
+		"outputs/1/data": v0,
+		"outputs/2/data": v1,
+		"outputs/3/data": v1,
+	}
+
+	var found int
+	for _, lnk := range tx.Links() {
+		c, ok := expected[lnk.Name]
+		if !ok {
+			if strings.HasPrefix(lnk.Name, "outputs/") {
+				t.Fatalf("unexpected link %s", lnk.Name)
+			}
+			continue
+		}
+		if !lnk.Cid.Equals(c) {
+			t.Fatalf("%s: expected %s, got %s", lnk.Name, c, lnk.Cid)
+		}
+		found++
+	}
+	if found != len(expected) {
+		t.Fatalf("expected %d data links, got %d", len(expected), found)
+	}
+
+	lnk, rest, err := tx.ResolveLink([]string{"outputs", "1", "data", "foo", "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lnk.Cid.Equals(v0) || len(rest) != 2 || rest[0] != "foo" {
+		t.Fatalf("expected link to %s with the rest of the path, got %s %v", v0, lnk.Cid, rest)
+	}
+
+	for _, i := range []string{"0", "4", "5"} {
+		if _, _, err := tx.Resolve([]string{"outputs", i, "data"}); err == nil {
+			t.Fatalf("output %s: expected no data link", i)
+		}
+	}
+}
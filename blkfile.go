@@ -0,0 +1,218 @@
+package ipldbtc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// maxBlkFileBlockSize bounds the size prefix accepted for a block in a
+// blk*.dat file, matching the largest serialized block allowed by consensus.
+const maxBlkFileBlockSize = 4000000
+
+// blkFileMagics maps the network magic values that prefix blocks in
+// blk*.dat files, for mainnet, testnet3, testnet4, signet and regtest, to
+// their networks.
+var blkFileMagics = map[[4]byte]*Network{
+	{0xf9, 0xbe, 0xb4, 0xd9}: MainNet,
+	{0x0b, 0x11, 0x09, 0x07}: TestNet,
+	{0x1c, 0x16, 0x3f, 0x28}: TestNet,
+	{0x0a, 0x03, 0xcf, 0x40}: SigNet,
+	{0xfa, 0xbf, 0xb5, 0xda}: RegTest,
+}
+
+// BlkFileBlock is a block read from a Bitcoin Core blk*.dat file.
+type BlkFileBlock struct {
+	// Magic is the network magic the block was stored with.
+	Magic [4]byte
+
+	// Offset is the position of the block header in the file, just after
+	// the magic and size prefix.
+	Offset int64
+
+	// Data holds the complete serialized block, as accepted by
+	// DecodeBlockMessage.
+	Data []byte
+
+	Block *Block
+	Txs   []*BlkFileTx
+}
+
+// BlkFileTx is a transaction read from a blk*.dat file along with its
+// position in the file.
+type BlkFileTx struct {
+	Offset int64
+	Tx     *Tx
+}
+
+// BlkFileReader iterates over the blocks stored in a Bitcoin Core blk*.dat
+// file. Each block is prefixed by the 4 byte network magic and its 4 byte
+// little endian size; files may end in zero padding left by preallocation.
+// The transactions read resolve their addresses for the network of the
+// magic.
+type BlkFileReader struct {
+	r      io.Reader
+	off    int64
+	xorKey []byte
+}
+
+// NewBlkFileReader returns a reader for the blk*.dat file contents in r.
+// xorKey is the obfuscation key from the xor.dat file written by newer
+// versions of Bitcoin Core, or nil if the file is not obfuscated.
+func NewBlkFileReader(r io.Reader, xorKey []byte) *BlkFileReader {
+	if bytes.Count(xorKey, []byte{0}) == len(xorKey) {
+		xorKey = nil
+	}
+
+	return &BlkFileReader{
+		r:      bufio.NewReader(r),
+		xorKey: xorKey,
+	}
+}
+
+// Next returns the next block in the file, or io.EOF once the end of the
+// file or its zero padded tail is reached.
+func (br *BlkFileReader) Next() (*BlkFileBlock, error) {
+	var magic [4]byte
+	n, err := io.ReadFull(br.r, magic[:])
+	if err == io.EOF || (err == io.ErrUnexpectedEOF && bytes.Count(magic[:n], []byte{0}) == n) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, newDecodeError("magic", br.off, err)
+	}
+
+	// preallocated space at the end of the file is never obfuscated
+	if magic == [4]byte{} {
+		return nil, io.EOF
+	}
+	br.deobfuscate(magic[:])
+	br.off += 4
+
+	if _, ok := blkFileMagics[magic]; !ok {
+		return nil, newDecodeError("magic", br.off-4, fmt.Errorf("unknown network magic %x", magic))
+	}
+
+	size := make([]byte, 4)
+	if err := br.read("size", size); err != nil {
+		return nil, err
+	}
+
+	blkSize := binary.LittleEndian.Uint32(size)
+	if blkSize > maxBlkFileBlockSize {
+		return nil, newDecodeError("size", br.off-4, fmt.Errorf("%w: %d", ErrOversize, blkSize))
+	}
+	if blkSize < 80 {
+		return nil, newDecodeError("size", br.off-4, fmt.Errorf("block size %d smaller than a header", blkSize))
+	}
+
+	out := &BlkFileBlock{
+		Magic:  magic,
+		Offset: br.off,
+		Data:   make([]byte, blkSize),
+	}
+	if err := br.read("block", out.Data); err != nil {
+		return nil, err
+	}
+
+	if err := out.decode(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// read fills buf with field from the file, removing any obfuscation.
+func (br *BlkFileReader) read(field string, buf []byte) error {
+	if _, err := io.ReadFull(br.r, buf); err != nil {
+		return newDecodeError(field, br.off, err)
+	}
+
+	br.deobfuscate(buf)
+	br.off += int64(len(buf))
+	return nil
+}
+
+// deobfuscate removes the xor obfuscation from buf, which was read from the
+// current offset.
+func (br *BlkFileReader) deobfuscate(buf []byte) {
+	if br.xorKey == nil {
+		return
+	}
+
+	for i := range buf {
+		buf[i] ^= br.xorKey[(br.off+int64(i))%int64(len(br.xorKey))]
+	}
+}
+
+// decode parses the block data, reporting errors with offsets into the
+// file.
+func (fb *BlkFileBlock) decode() error {
+	r := &reader{
+		br:  bufio.NewReader(bytes.NewReader(fb.Data)),
+		off: fb.Offset,
+	}
+	blk, err := readBlock(r)
+	if err != nil {
+		return err
+	}
+	fb.Block = blk
+
+	nTx, err := readVarint(r, "tx_count")
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < nTx; i++ {
+		off := r.off
+		tx, err := readTxFrom(r)
+		if err != nil {
+			return withTxIndex(err, i)
+		}
+		tx.Network = blkFileMagics[fb.Magic]
+
+		fb.Txs = append(fb.Txs, &BlkFileTx{Offset: off, Tx: tx})
+	}
+
+	if r.off != fb.Offset+int64(len(fb.Data)) {
+		return newDecodeError("block", fb.Offset, fmt.Errorf("block size mismatch: %d bytes decoded, %d stored", r.off-fb.Offset, len(fb.Data)))
+	}
+
+	return nil
+}
+
+// ReadXORKey reads the block file obfuscation key from the xor.dat file in
+// a Bitcoin Core blocks directory. It returns a nil key if the directory has
+// no xor.dat, as written by versions before obfuscation was introduced.
+func ReadXORKey(blocksDir string) ([]byte, error) {
+	key, err := os.ReadFile(filepath.Join(blocksDir, "xor.dat"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != 8 {
+		return nil, fmt.Errorf("invalid xor.dat key length: %d", len(key))
+	}
+
+	return key, nil
+}
+
+// BlkFiles lists the blk*.dat files in a Bitcoin Core blocks directory in
+// the order they were written.
+func BlkFiles(blocksDir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(blocksDir, "blk[0-9]*.dat"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,107 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeBlkFile(t *testing.T, xorKey []byte, blocks ...[]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		buf.Write([]byte{0xf9, 0xbe, 0xb4, 0xd9})
+		binary.Write(&buf, binary.LittleEndian, uint32(len(b)))
+		buf.Write(b)
+	}
+
+	out := buf.Bytes()
+	if xorKey != nil {
+		for i := range out {
+			out[i] ^= xorKey[i%len(xorKey)]
+		}
+	}
+
+	// preallocated tail
+	return append(out, make([]byte, 1000)...)
+}
+
+func TestBlkFileReader(t *testing.T) {
+	blocks := [][]byte{loadFixture(t, "block.hex"), loadFixture(t, "segwit3.hex")}
+
+	for _, key := range [][]byte{nil, {0x13, 0x37, 0x00, 0xff, 0xa5, 0x5a, 0x01, 0x80}} {
+		file := writeBlkFile(t, key, blocks...)
+		plain := writeBlkFile(t, nil, blocks...)
+
+		r := NewBlkFileReader(bytes.NewReader(file), key)
+		for i, data := range blocks {
+			fb, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(fb.Data, data) {
+				t.Fatalf("block %d: data mismatch", i)
+			}
+
+			if !bytes.Equal(plain[fb.Offset:fb.Offset+80], fb.Block.RawData()) {
+				t.Fatalf("block %d: header offset is wrong", i)
+			}
+
+			for j, ftx := range fb.Txs {
+				raw := ftx.Tx.RawData()
+				if !bytes.Equal(plain[ftx.Offset:ftx.Offset+int64(len(raw))], raw) {
+					t.Fatalf("block %d: tx %d offset is wrong", i, j)
+				}
+			}
+		}
+
+		if _, err := r.Next(); err != io.EOF {
+			t.Fatalf("expected io.EOF at padded tail, got %v", err)
+		}
+	}
+
+	truncated := writeBlkFile(t, nil, blocks[0])[:1000]
+	if _, err := NewBlkFileReader(bytes.NewReader(truncated), nil).Next(); err == nil {
+		t.Fatal("expected error reading truncated block")
+	}
+}
+
+func TestBlkFilesDir(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := ReadXORKey(dir)
+	if err != nil || key != nil {
+		t.Fatalf("expected no key without xor.dat, got %x, %v", key, err)
+	}
+
+	xor := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	for name, data := range map[string][]byte{
+		"xor.dat":      xor,
+		"blk00001.dat": nil,
+		"blk00000.dat": nil,
+		"rev00000.dat": nil,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, err = ReadXORKey(dir)
+	if err != nil || !bytes.Equal(key, xor) {
+		t.Fatalf("expected key %x, got %x, %v", xor, key, err)
+	}
+
+	files, err := BlkFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 || filepath.Base(files[0]) != "blk00000.dat" || filepath.Base(files[1]) != "blk00001.dat" {
+		t.Fatalf("unexpected block files: %v", files)
+	}
+}
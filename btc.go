@@ -5,14 +5,20 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"strings"
 
 	cid "github.com/ipfs/go-cid"
 	node "github.com/ipfs/go-ipld-format"
 	mh "github.com/multiformats/go-multihash"
 )
 
+// Block is a block header. The transactions of a block are separate nodes
+// linked through its merkle tree; FullBlock keeps them together with the
+// header.
 type Block struct {
-	rawdata []byte
+	// txSize is the cumulative size of the merkle tree of transactions, if
+	// known
+	txSize uint64
 
 	Version    uint32  `json:"version"`
 	Parent     cid.Cid `json:"parent"`
@@ -43,6 +49,7 @@ func (b *Block) Links() []*node.Link {
 		{
 			Name: "tx",
 			Cid:  b.MerkleRoot,
+			Size: b.txSize,
 		},
 		{
 			Name: "parent",
@@ -96,6 +103,28 @@ func (b *Block) ResolveLink(path []string) (*node.Link, []string, error) {
 	return lnk, rest, nil
 }
 
+// filterTree returns the paths below p, relative to it, of at most depth
+// components, or all of them if depth is negative, as the Tree method of a
+// node does given all of its paths.
+func filterTree(paths []string, p string, depth int) []string {
+	p = strings.Trim(p, "/")
+
+	var out []string
+	for _, path := range paths {
+		if p != "" {
+			if !strings.HasPrefix(path, p+"/") {
+				continue
+			}
+			path = path[len(p)+1:]
+		}
+
+		if depth < 0 || strings.Count(path, "/") < depth {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
 func cidToHash(c cid.Cid) []byte {
 	h := []byte(c.Hash())
 	return h[len(h)-32:]
@@ -129,12 +158,25 @@ func (b *Block) header() []byte {
 	return buf.Bytes()
 }
 
+// Size returns the size of the header. FullBlock reports the size of the
+// whole block.
 func (b *Block) Size() (uint64, error) {
-	return uint64(len(b.rawdata)), nil
+	return uint64(len(b.header())), nil
 }
 
+// Stat reports the size of the header. For a block returned by
+// DecodeBlockMessage the cumulative size also covers its merkle tree and
+// transactions, but not the parent blocks. The weight of the whole block
+// depends on its transactions, see Weight.
 func (b *Block) Stat() (*node.NodeStat, error) {
-	return &node.NodeStat{}, nil
+	size := len(b.header())
+	return &node.NodeStat{
+		Hash:           b.Cid().String(),
+		NumLinks:       len(b.Links()),
+		BlockSize:      size,
+		DataSize:       size,
+		CumulativeSize: size + int(b.txSize),
+	}, nil
 }
 
 func (b *Block) String() string {
@@ -142,8 +184,7 @@ func (b *Block) String() string {
 }
 
 func (b *Block) Tree(p string, depth int) []string {
-	// TODO: this isnt a correct implementation yet
-	return []string{"difficulty", "nonce", "version", "timestamp", "tx", "parent"}
+	return filterTree([]string{"difficulty", "nonce", "version", "timestamp", "tx", "parent"}, p, depth)
 }
 
 func (b *Block) BTCSha() []byte {
@@ -3,12 +3,20 @@ package ipldbtc
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"strings"
 	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
 )
 
 var txdata = "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff6403a6ab05e4b883e5bda9e7a59ee4bb99e9b1bc76a3a2bb0e9c92f06e4a6349de9ccc8fbe0fad11133ed73c78ee12876334c13c02000000f09f909f2f4249503130302f4d696e65642062792073647a6861626364000000000000000000000000000000005f77dba4015ca34297000000001976a914c825a1ecf2a6830c4401620c3a16f1995057c2ab88acfe75853a"
@@ -300,3 +308,671 @@ func TestTxDecoding(t *testing.T) {
 		t.Fatal("seqno not right")
 	}
 }
+
+// blockTxs returns the transactions of a block decoded by
+// DecodeBlockMessage, the Tx nodes that follow its header.
+func blockTxs(nodes []node.Node) []*Tx {
+	var txs []*Tx
+	for _, n := range nodes[1:] {
+		tx, ok := n.(*Tx)
+		if !ok {
+			break
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+func loadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	hexdata, err := os.ReadFile("fixtures/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hexString := strings.TrimSpace(string(hexdata))
+	if len(hexString)%2 != 0 {
+		hexString = hexString[:len(hexString)-1]
+	}
+
+	data, err := hex.DecodeString(hexString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestDecodeNode(t *testing.T) {
+	nodes, err := DecodeBlockMessage(loadFixture(t, "segwit.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reg node.Registry
+	RegisterDecoders(&reg)
+
+	for i, n := range nodes {
+		blk, err := blocks.NewBlockWithCid(n.RawData(), n.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := reg.Decode(blk)
+		if err != nil {
+			t.Fatalf("node %d: %s", i, err)
+		}
+
+		if fmt.Sprintf("%T", out) != fmt.Sprintf("%T", n) {
+			t.Fatalf("node %d: decoded as %T, expected %T", i, out, n)
+		}
+
+		if !out.Cid().Equals(n.Cid()) {
+			t.Fatalf("node %d: cid mismatch", i)
+		}
+	}
+
+	// a well formed 64 byte transaction is not mistaken for a tx tree node
+	tx := &Tx{
+		Version: 1,
+		Inputs: []*TxIn{{
+			PrevTx: hashToCid(make([]byte, 32), cid.BitcoinTx),
+			Script: []byte{1, 2, 3, 4},
+			SeqNo:  0xffffffff,
+		}},
+		Outputs: []*TxOut{{Value: 5000}},
+	}
+	if len(tx.RawData()) != 64 {
+		t.Fatalf("expected 64 byte transaction, got %d", len(tx.RawData()))
+	}
+
+	blk, err := blocks.NewBlockWithCid(tx.RawData(), tx.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := DecodeNode(blk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := out.(*Tx); !ok {
+		t.Fatalf("expected a transaction, got %T", out)
+	}
+
+	bad, err := blocks.NewBlockWithCid(tx.RawData(), nodes[1].Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecodeNode(bad); err == nil {
+		t.Fatal("expected error decoding block with mismatched cid")
+	}
+
+	// the witness serialization of a segwit transaction is only accepted
+	// under its wtxid
+	for _, n := range nodes {
+		wtx, ok := n.(*Tx)
+		if !ok || !wtx.HasWitness() {
+			continue
+		}
+
+		bad, err := blocks.NewBlockWithCid(wtx.RawData(), wtx.Stripped().Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := DecodeNode(bad); err == nil {
+			t.Fatal("expected error decoding witness transaction under its txid")
+		}
+		break
+	}
+}
+
+func TestTxRoundTrip(t *testing.T) {
+	for _, fixture := range []string{"block.hex", "segwit.hex", "segwit2.hex", "segwit3.hex"} {
+		t.Run(fixture, func(t *testing.T) {
+			data := loadFixture(t, fixture)
+			nodes, err := DecodeBlockMessage(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the header, tx count and every raw transaction must add up to
+			// the original block
+			buf := bytes.NewBuffer(nodes[0].RawData())
+			txs := blockTxs(nodes)
+			writeVarInt(buf, uint64(len(txs)))
+
+			var segwit int
+			for i, tx := range txs {
+				raw := tx.RawData()
+				if !bytes.Equal(data[buf.Len():buf.Len()+len(raw)], raw) {
+					t.Fatalf("tx %d did not round trip", i)
+				}
+				buf.Write(raw)
+
+				dtx, err := DecodeTx(raw)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(dtx.RawData(), raw) {
+					t.Fatalf("tx %d did not round trip through DecodeTx", i)
+				}
+
+				if tx.HasWitness() {
+					segwit++
+					if tx.Stripped().HexHash() == tx.WitnessHexHash() {
+						t.Fatalf("tx %d has witness data but txid equals wtxid", i)
+					}
+				} else if !bytes.Equal(tx.StrippedData(), raw) {
+					t.Fatalf("tx %d has no witness data but stripped data differs", i)
+				}
+
+				// each node reports the identity its CID is derived from
+				for _, nd := range []*Tx{tx, tx.Stripped()} {
+					if !bytes.Equal(cidToHash(nd.Cid()), nd.BTCSha()) {
+						t.Fatalf("tx %d: hash %s does not match cid %s", i, nd.HexHash(), nd.Cid())
+					}
+				}
+			}
+
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Fatal("block did not round trip")
+			}
+
+			if fixture != "block.hex" && segwit == 0 {
+				t.Fatal("expected segwit transactions in fixture")
+			}
+		})
+	}
+}
+
+func TestWitnessCommitment(t *testing.T) {
+	nodes, err := DecodeBlockMessage(loadFixture(t, "segwit2.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wc *WitnessCommitment
+	byCid := make(map[cid.Cid]node.Node)
+	for _, n := range nodes {
+		byCid[n.Cid()] = n
+		if n, ok := n.(*WitnessCommitment); ok {
+			wc = n
+		}
+	}
+
+	if wc == nil {
+		t.Fatal("no witness commitment decoded")
+	}
+
+	coinbase := nodes[1].(*Tx)
+	lnk, rest, err := coinbase.ResolveLink([]string{"witnessCommitment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rest) != 0 || !lnk.Cid.Equals(wc.Cid()) {
+		t.Fatal("coinbase does not link to the witness commitment")
+	}
+
+	back, err := DecodeWitnessCommitment(wc.RawData())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !back.Cid().Equals(wc.Cid()) {
+		t.Fatal("witness commitment did not round trip")
+	}
+
+	// walk the wtxid tree and check every leaf is the wtxid of a
+	// transaction in the block, in order
+	var leaves []cid.Cid
+	var walk func(c cid.Cid)
+	walk = func(c cid.Cid) {
+		tree, ok := byCid[c].(*TxTree)
+		if !ok {
+			leaves = append(leaves, c)
+			return
+		}
+		walk(tree.Left.Cid)
+		if !tree.Right.Cid.Equals(tree.Left.Cid) {
+			walk(tree.Right.Cid)
+		}
+	}
+	walk(wc.WitnessMerkleRoot.Cid)
+
+	txs := blockTxs(nodes)
+
+	if len(leaves) != len(txs) {
+		t.Fatalf("expected %d wtxid leaves, got %d", len(txs), len(leaves))
+	}
+
+	for i, tx := range txs[1:] {
+		if !bytes.Equal(cidToHash(leaves[i+1]), tx.WitnessSha()) {
+			t.Fatalf("leaf %d is not the wtxid of tx %d", i+1, i+1)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := loadFixture(t, "block.hex")
+
+	_, err := DecodeBlockMessage(data[:len(data)-10])
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("expected a DecodeError, got %v", err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF cause, got %v", err)
+	}
+	if de.TxIndex < 0 || de.Field == "" || de.Offset <= 80 || de.Offset >= int64(len(data)) {
+		t.Fatalf("unexpected error details: %+v", de)
+	}
+
+	// tx count of 1 encoded in three bytes
+	noncanon := append(append([]byte{}, data[:80]...), 0xfd, 0x01, 0x00)
+	if _, err := DecodeBlockMessage(noncanon); !errors.Is(err, ErrNonCanonicalVarint) {
+		t.Fatalf("expected ErrNonCanonicalVarint, got %v", err)
+	}
+
+	oversize := append(append([]byte{}, data[:80]...), 0xfe, 0xff, 0xff, 0xff, 0xff)
+	_, err = DecodeBlockMessage(oversize)
+	if !errors.Is(err, ErrOversize) || !errors.As(err, &de) || de.Field != "tx_count" || de.Offset != 80 {
+		t.Fatalf("expected oversize tx_count at offset 80, got %v", err)
+	}
+
+	// the segwit marker with only empty witnesses
+	nodes, err := DecodeBlockMessage(loadFixture(t, "segwit.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := *blockTxs(nodes)[1]
+	empty.Witnesses = make([]*Witness, len(empty.Inputs))
+	raw := empty.serialize(true)
+	_, err = DecodeTx(raw)
+	if !errors.Is(err, ErrSuperfluousWitness) || !errors.As(err, &de) || de.Field != "witness" {
+		t.Fatalf("expected a superfluous witness error, got %v", err)
+	}
+	if _, err := DecodeTx(empty.RawData()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	for _, fixture := range []string{"block.hex", "segwit.hex", "segwit2.hex", "segwit3.hex"} {
+		data := loadFixture(t, fixture)
+		if _, err := DecodeBlockMessage(data, VerifyRoundTrip()); err != nil {
+			t.Fatalf("%s: %s", fixture, err)
+		}
+	}
+
+	data := loadFixture(t, "segwit.hex")
+	nodes, err := DecodeBlockMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := blockTxs(nodes)
+	// the witness tree comes before the commitment, the txid tree after it
+	var wtrees, txtrees []*TxTree
+	trees := &wtrees
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *WitnessCommitment:
+			trees = &txtrees
+		case *TxTree:
+			*trees = append(*trees, n)
+		}
+	}
+	leaves := make([]cid.Cid, len(txs))
+	for i, tx := range txs {
+		leaves[i] = tx.Stripped().Cid()
+	}
+
+	checkErr := func(err error, node string, index int) {
+		t.Helper()
+		var rte *RoundTripError
+		if !errors.As(err, &rte) || rte.Node != node || rte.Index != index {
+			t.Fatalf("expected %s %d to fail the round trip, got %v", node, index, err)
+		}
+	}
+
+	blk := *nodes[0].(*Block)
+	if err := verifyHeader(&blk, data[:80]); err != nil {
+		t.Fatal(err)
+	}
+	blk.Nonce++
+	checkErr(verifyHeader(&blk, data[:80]), "header", 0)
+
+	tx := *txs[3]
+	raw := tx.RawData()
+	tx.LockTime++
+	checkErr(verifyTx(&tx, raw, 3, 1000), "tx", 3)
+
+	if err := verifyTxTrees(wtrees, witnessLeaves(txs), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyTxTrees(txtrees, leaves, len(wtrees)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a witness tree node linking to the wrong hash, and a txid tree node
+	// whose link has the wrong codec for its bytes
+	bad := append([]*TxTree{}, wtrees...)
+	bad[1] = &TxTree{Left: bad[1].Left, Right: &node.Link{Cid: hashToCid(make([]byte, 32), cid.BitcoinTx)}}
+	checkErr(verifyTxTrees(bad, witnessLeaves(txs), 0), "tx_tree", 1)
+
+	bad = append([]*TxTree{}, txtrees...)
+	bad[2] = &TxTree{Left: bad[2].Left, Right: &node.Link{Cid: hashToCid(cidToHash(bad[2].Right.Cid), cid.BitcoinBlock)}}
+	checkErr(verifyTxTrees(bad, leaves, len(wtrees)), "tx_tree", len(wtrees)+2)
+
+	// a missing node
+	checkErr(verifyTxTrees(txtrees[:len(txtrees)-1], leaves, len(wtrees)), "tx_tree", len(wtrees)+len(txtrees)-1)
+}
+
+func encodeBlock(t *testing.T, blk *Block, txs []*Tx) []byte {
+	t.Helper()
+
+	buf := bytes.NewBuffer(blk.RawData())
+	if _, err := writeVarInt(buf, uint64(len(txs))); err != nil {
+		t.Fatal(err)
+	}
+	for _, tx := range txs {
+		buf.Write(tx.WitnessData())
+	}
+	return buf.Bytes()
+}
+
+// singleTxSegwitBlock returns a block holding only a segwit coinbase, which
+// commits to an all zero witness reserved value.
+func singleTxSegwitBlock(t *testing.T) (*Block, *Tx) {
+	t.Helper()
+
+	zero := make([]byte, 32)
+	commitment, _ := mh.Sum(append(append([]byte{}, zero...), zero...), mh.DBL_SHA2_256, -1)
+	coinbase := &Tx{
+		Version: 1,
+		Inputs: []*TxIn{{
+			PrevTx:      hashToCid(zero, cid.BitcoinTx),
+			PrevTxIndex: 0xffffffff,
+			Script:      []byte{0x01, 0x01},
+			SeqNo:       0xffffffff,
+		}},
+		Outputs: []*TxOut{
+			{Value: 5000000000, Script: []byte{0x51}},
+			{Script: append(append([]byte{}, witnessCommitmentHeader...), commitment[2:]...)},
+		},
+		Witnesses: []*Witness{{Data: [][]byte{zero}}},
+	}
+	blk := &Block{
+		Version:    0x20000000,
+		Parent:     hashToCid(zero, cid.BitcoinBlock),
+		MerkleRoot: coinbase.Stripped().Cid(),
+	}
+	return blk, coinbase
+}
+
+func TestSingleTxSegwitBlock(t *testing.T) {
+	blk, coinbase := singleTxSegwitBlock(t)
+	nodes, err := DecodeBlockMessage(encodeBlock(t, blk, []*Tx{coinbase}), VerifyRoundTrip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stripped coinbase is the merkle root, and comes last after the
+	// witness commitment
+	if len(nodes) != 4 || !nodes[1].Cid().Equals(coinbase.Cid()) {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+	if _, ok := nodes[2].(*WitnessCommitment); !ok {
+		t.Fatalf("expected the witness commitment, got %T", nodes[2])
+	}
+	if !nodes[3].Cid().Equals(blk.MerkleRoot) {
+		t.Fatalf("expected the merkle root last, got %s", nodes[3].Cid())
+	}
+
+	// a commitment to another reserved value fails, unless the merkle checks
+	// are skipped
+	bad := *coinbase
+	bad.Witnesses = []*Witness{{Data: [][]byte{bytes.Repeat([]byte{1}, 32)}}}
+	data := encodeBlock(t, blk, []*Tx{&bad})
+	if _, err := DecodeBlockMessage(data); err == nil {
+		t.Fatal("expected a witness commitment mismatch")
+	}
+	nodes, err = DecodeBlockMessage(data, SkipMerkleCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nodes[2].(*WitnessCommitment); !ok {
+		t.Fatalf("expected the computed witness commitment, got %T", nodes[2])
+	}
+}
+
+func TestMerkleRootVerification(t *testing.T) {
+	nodes, err := DecodeBlockMessage(loadFixture(t, "block.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blk := nodes[0].(*Block)
+	txs := blockTxs(nodes)
+	if len(txs)%2 != 1 {
+		t.Fatal("fixture should have an odd number of transactions")
+	}
+
+	tampered := make([]*Tx, len(txs))
+	copy(tampered, txs)
+	changed := *txs[5]
+	changed.LockTime++
+	tampered[5] = &changed
+
+	// repeating the last transaction of an odd sized list keeps the root
+	mutated := append(append([]*Tx{}, txs...), txs[len(txs)-1])
+
+	for _, c := range []struct {
+		txs []*Tx
+		err error
+	}{
+		{tampered, ErrMerkleRootMismatch},
+		{mutated, ErrMutatedMerkleTree},
+		{nil, ErrMerkleRootMismatch},
+	} {
+		data := encodeBlock(t, blk, c.txs)
+
+		if _, err := DecodeBlockMessage(data); !errors.Is(err, c.err) {
+			t.Fatalf("expected %v, got %v", c.err, err)
+		}
+
+		err := NewBlockStreamDecoder(bytes.NewReader(data)).Decode(context.Background(), func(node.Node) error { return nil })
+		if !errors.Is(err, c.err) {
+			t.Fatalf("stream: expected %v, got %v", c.err, err)
+		}
+
+		if _, err := DecodeBlockMessage(data, SkipMerkleCheck()); err != nil {
+			t.Fatalf("expected no error when skipping the merkle check, got %v", err)
+		}
+
+		err = NewBlockStreamDecoder(bytes.NewReader(data), SkipMerkleCheck()).Decode(context.Background(), func(node.Node) error { return nil })
+		if err != nil {
+			t.Fatalf("stream: expected no error when skipping the merkle check, got %v", err)
+		}
+	}
+}
+
+func TestStat(t *testing.T) {
+	for _, name := range []string{"block.hex", "segwit.hex"} {
+		nodes, err := DecodeBlockMessage(loadFixture(t, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txs := blockTxs(nodes)
+		var leaves []cid.Cid
+		expected := 80
+		for _, tx := range txs {
+			leaves = append(leaves, tx.Stripped().Cid())
+			expected += len(tx.StrippedData())
+		}
+		trees, _, _ := mkMerkleTree(leaves)
+		expected += 64 * len(trees)
+
+		for _, nd := range nodes {
+			st, err := nd.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Hash != nd.Cid().String() || st.NumLinks != len(nd.Links()) || st.BlockSize != len(nd.RawData()) {
+				t.Fatalf("%s: unexpected stat %s for %s", name, st, nd)
+			}
+		}
+
+		st, _ := nodes[0].Stat()
+		if st.CumulativeSize != expected {
+			t.Fatalf("%s: expected cumulative size %d, got %d", name, expected, st.CumulativeSize)
+		}
+
+		// the merkle root holds everything but the header
+		st, _ = nodes[len(nodes)-1].Stat()
+		if st.CumulativeSize != expected-80 {
+			t.Fatalf("%s: expected cumulative size %d for the merkle root, got %d", name, expected-80, st.CumulativeSize)
+		}
+
+		st, _ = txs[1].Stat()
+		if st.CumulativeSize != len(txs[1].RawData()) || st.DataSize != st.BlockSize {
+			t.Fatalf("%s: unexpected stat %s for a transaction", name, st)
+		}
+	}
+}
+
+// checkTree walks every path listed by the Tree of nd, which must resolve
+// completely, and checks that each path is listed once, along with its parent.
+func checkTree(t *testing.T, nd node.Node) {
+	t.Helper()
+
+	all := nd.Tree("", -1)
+	seen := make(map[string]bool)
+	for _, path := range all {
+		if seen[path] {
+			t.Fatalf("%s: %s listed twice", nd, path)
+		}
+		seen[path] = true
+
+		_, rest, err := nd.Resolve(strings.Split(path, "/"))
+		if err != nil {
+			t.Fatalf("%s: %s: %s", nd, path, err)
+		}
+		if len(rest) != 0 {
+			t.Fatalf("%s: %s: unresolved %v", nd, path, rest)
+		}
+	}
+
+	for _, path := range all {
+		if i := strings.LastIndex(path, "/"); i >= 0 && !seen[path[:i]] {
+			t.Fatalf("%s: %s listed without its parent", nd, path)
+		}
+	}
+
+	if len(nd.Tree("", 0)) != 0 {
+		t.Fatalf("%s: paths listed at depth 0", nd)
+	}
+}
+
+func TestTree(t *testing.T) {
+	for _, name := range []string{"block.hex", "segwit.hex"} {
+		data := loadFixture(t, name)
+		nodes, err := DecodeBlockMessage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a sample of each kind of node, and every transaction of the
+		// smaller block
+		kinds := make(map[string]int)
+		for _, nd := range nodes {
+			kind := fmt.Sprintf("%T", nd)
+			if kinds[kind] < 50 || name == "block.hex" {
+				checkTree(t, nd)
+			}
+			kinds[kind]++
+		}
+
+		fb, err := DecodeFullBlock(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, fb)
+	}
+
+	f := loadPsbtFixtures(t)
+	for _, test := range f.Valid {
+		checkTree(t, mustDecodePsbt(t, test.Psbt))
+	}
+	for _, name := range []string{"combined", "finalized", "unknownCombined"} {
+		checkTree(t, mustDecodePsbt(t, f.Workflow[name]))
+	}
+
+	tx, err := DecodeTx(loadFixture(t, "block.hex")[81:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := strings.Join(tx.Tree("", 1), ",")
+	if paths != "version,lockTime,inputs,outputs" {
+		t.Fatalf("unexpected top level paths %s", paths)
+	}
+}
+
+func TestTreePrefixAndDepth(t *testing.T) {
+	nodes, err := DecodeBlockMessage(loadFixture(t, "segwit.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wc *WitnessCommitment
+	var tree *TxTree
+	for _, nd := range nodes {
+		switch nd := nd.(type) {
+		case *WitnessCommitment:
+			wc = nd
+		case *TxTree:
+			tree = nd
+		}
+	}
+
+	p := mustDecodePsbt(t, loadPsbtFixtures(t).Valid[0].Psbt)
+
+	cases := []struct {
+		nd       node.Node
+		prefix   string
+		depth    int
+		expected string
+	}{
+		{nodes[0], "", -1, "difficulty,nonce,version,timestamp,tx,parent"},
+		{nodes[0], "", 1, "difficulty,nonce,version,timestamp,tx,parent"},
+		{nodes[0], "tx", -1, ""},
+		{nodes[1], "", 1, "version,lockTime,inputs,outputs,witnesses,witnessCommitment"},
+		{nodes[1], "", 2, "version,lockTime,inputs,outputs,inputs/0,outputs/0,outputs/1,witnesses,witnesses/0,witnessCommitment"},
+		{nodes[1], "inputs/0", -1, "prevTx,seqNo,script,script/asm"},
+		{nodes[1], "/inputs/0/", 1, "prevTx,seqNo,script"},
+		{nodes[1], "outputs/0", 1, "value,type,address,script"},
+		{nodes[1], "witnesses", -1, "0,0/0"},
+		{nodes[1], "inputs/1", -1, ""},
+		{tree, "", -1, "0,1"},
+		{tree, "0", -1, ""},
+		{wc, "", 1, "witnessMerkleRoot,nonce"},
+		{wc, "nonce", -1, ""},
+		{p, "", 1, "tx,version,inputs,outputs,unsignedTx"},
+		{p, "", 2, "tx,version,inputs,outputs,unsignedTx,inputs/0,outputs/0,outputs/1"},
+		{p, "inputs", -1, "0,0/nonWitnessUtxo"},
+		{p, "inputs/0", 1, "nonWitnessUtxo"},
+	}
+
+	for _, c := range cases {
+		got := strings.Join(c.nd.Tree(c.prefix, c.depth), ",")
+		if got != c.expected {
+			t.Fatalf("%s: Tree(%q, %d) returned %q, expected %q", c.nd, c.prefix, c.depth, got, c.expected)
+		}
+	}
+}
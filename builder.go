@@ -0,0 +1,184 @@
+package ipldbtc
+
+import (
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+const (
+	// SequenceFinal is the sequence number of an input that opts out of
+	// lock time and replacement.
+	SequenceFinal = 0xffffffff
+
+	// SequenceMaxRBF is the largest sequence number signalling BIP125
+	// replaceability.
+	SequenceMaxRBF = 0xfffffffd
+)
+
+// TxBuilder assembles a transaction. Inputs are added by the outpoint they
+// spend together with the output found there, which is needed to compute
+// the fee; outputs by script or address.
+type TxBuilder struct {
+	tx       Tx
+	prevOuts []*TxOut
+}
+
+// NewTxBuilder returns a builder for a version 2 transaction with no lock
+// time.
+func NewTxBuilder() *TxBuilder {
+	return &TxBuilder{tx: Tx{Version: 2}}
+}
+
+// SetVersion sets the version of the transaction.
+func (b *TxBuilder) SetVersion(version uint32) {
+	b.tx.Version = version
+}
+
+// SetLockTime sets the lock time of the transaction. It is only enforced if
+// at least one input has a sequence number below SequenceFinal.
+func (b *TxBuilder) SetLockTime(lockTime uint32) {
+	b.tx.LockTime = lockTime
+}
+
+// AddInput adds an input spending output index of the transaction prevTx,
+// and returns its index. prevOut is the output spent, or nil if unknown, in
+// which case the fee cannot be computed. The input starts with an empty
+// signature script and sequence number SequenceFinal.
+func (b *TxBuilder) AddInput(prevTx cid.Cid, index uint32, prevOut *TxOut) int {
+	b.tx.Inputs = append(b.tx.Inputs, &TxIn{
+		PrevTx:      prevTx,
+		PrevTxIndex: index,
+		Script:      Script{},
+		SeqNo:       SequenceFinal,
+	})
+	b.prevOuts = append(b.prevOuts, prevOut)
+	return len(b.tx.Inputs) - 1
+}
+
+// AddOutput adds an output paying value satoshis to script, and returns its
+// index.
+func (b *TxBuilder) AddOutput(script Script, value uint64) int {
+	b.tx.Outputs = append(b.tx.Outputs, &TxOut{Value: value, Script: script})
+	return len(b.tx.Outputs) - 1
+}
+
+// AddAddressOutput adds an output paying value satoshis to an address of
+// the given network, and returns its index.
+func (b *TxBuilder) AddAddressOutput(addr string, net *Network, value uint64) (int, error) {
+	script, err := AddressScript(addr, net)
+	if err != nil {
+		return 0, err
+	}
+	return b.AddOutput(script, value), nil
+}
+
+// SetSequence sets the sequence number of input i.
+func (b *TxBuilder) SetSequence(i int, seqNo uint32) error {
+	inp, err := b.input(i)
+	if err != nil {
+		return err
+	}
+	inp.SeqNo = seqNo
+	return nil
+}
+
+// SignalRBF lowers the sequence number of every input to at most
+// SequenceMaxRBF, marking the transaction as replaceable under BIP125.
+// Lower sequence numbers, such as relative lock times, are kept.
+func (b *TxBuilder) SignalRBF() {
+	for _, inp := range b.tx.Inputs {
+		if inp.SeqNo > SequenceMaxRBF {
+			inp.SeqNo = SequenceMaxRBF
+		}
+	}
+}
+
+// SetSigScript sets the signature script of input i.
+func (b *TxBuilder) SetSigScript(i int, script Script) error {
+	inp, err := b.input(i)
+	if err != nil {
+		return err
+	}
+	inp.Script = script
+	return nil
+}
+
+// SetWitness sets the witness stack of input i. The transaction is
+// serialized in the segwit format once any input has a non-empty witness.
+func (b *TxBuilder) SetWitness(i int, items ...[]byte) error {
+	if _, err := b.input(i); err != nil {
+		return err
+	}
+
+	for len(b.tx.Witnesses) < len(b.tx.Inputs) {
+		b.tx.Witnesses = append(b.tx.Witnesses, &Witness{})
+	}
+	b.tx.Witnesses[i] = &Witness{Data: items}
+	return nil
+}
+
+func (b *TxBuilder) input(i int) (*TxIn, error) {
+	if i < 0 || i >= len(b.tx.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", i)
+	}
+	return b.tx.Inputs[i], nil
+}
+
+// PrevOuts returns the outputs spent by the inputs, in order, as needed to
+// sign or verify the transaction.
+func (b *TxBuilder) PrevOuts() []*TxOut {
+	return append([]*TxOut(nil), b.prevOuts...)
+}
+
+// Build returns the transaction. It holds copies of the inputs, outputs and
+// witnesses, so the builder can be changed and built again.
+func (b *TxBuilder) Build() (*Tx, error) {
+	if len(b.tx.Inputs) == 0 {
+		return nil, fmt.Errorf("transaction has no inputs")
+	}
+	if len(b.tx.Outputs) == 0 {
+		return nil, fmt.Errorf("transaction has no outputs")
+	}
+	return b.build(), nil
+}
+
+func (b *TxBuilder) build() *Tx {
+	tx := &Tx{Version: b.tx.Version, LockTime: b.tx.LockTime}
+	for _, inp := range b.tx.Inputs {
+		in := *inp
+		tx.Inputs = append(tx.Inputs, &in)
+	}
+	for _, out := range b.tx.Outputs {
+		o := *out
+		tx.Outputs = append(tx.Outputs, &o)
+	}
+
+	// witnesses are only kept if there are any, so that the decoded form of
+	// a legacy transaction is matched
+	if b.tx.HasWitness() {
+		tx.Witnesses = make([]*Witness, len(tx.Inputs))
+		for i := range tx.Witnesses {
+			wit := &Witness{Data: [][]byte{}}
+			if i < len(b.tx.Witnesses) {
+				wit.Data = append(wit.Data, b.tx.Witnesses[i].Data...)
+			}
+			tx.Witnesses[i] = wit
+		}
+	}
+	return tx
+}
+
+// VSize returns the BIP141 virtual size of the transaction as currently
+// built. Signatures not yet attached are not counted, so a fee for an
+// unsigned transaction is best computed with placeholder witnesses.
+func (b *TxBuilder) VSize() int64 {
+	return b.build().VSize()
+}
+
+// Fee returns the amount of the spent outputs not paid to the outputs of
+// the transaction. It fails if an input was added without its spent output
+// or the outputs pay more than the inputs.
+func (b *TxBuilder) Fee() (uint64, error) {
+	return b.tx.Fee(b.prevOuts)
+}
@@ -0,0 +1,127 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestTxBuilder(t *testing.T) {
+	// rebuild the native P2WPKH example of BIP143
+	raw := mustHex(t, "01000000000102fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f00000000494830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac000247304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee0121025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee635711000000")
+	expected, err := DecodeTx(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevOuts := []*TxOut{
+		{Value: 625000000, Script: mustHex(t, "2103c9f4836b9a4f77fc0d81f7bcb01b7f1b35916864b9476c241ce9fc198bd25432ac")},
+		{Value: 600000000, Script: mustHex(t, "00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1")},
+	}
+
+	b := NewTxBuilder()
+	b.SetVersion(1)
+	b.SetLockTime(0x11)
+	b.AddInput(hashToCid(mustHex(t, "fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f"), cid.BitcoinTx), 0, prevOuts[0])
+	b.AddInput(hashToCid(mustHex(t, "ef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a"), cid.BitcoinTx), 1, prevOuts[1])
+
+	for _, out := range expected.Outputs {
+		addr, err := out.Script.Address(MainNet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.AddAddressOutput(addr, MainNet, out.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.SetSequence(0, 0xffffffee); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetSigScript(0, expected.Inputs[0].Script); err != nil {
+		t.Fatal(err)
+	}
+
+	// without witnesses the transaction is serialized in the legacy format
+	legacy, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Witnesses != nil || !bytes.Equal(legacy.RawData(), expected.StrippedData()) {
+		t.Fatal("expected a legacy serialization without witnesses")
+	}
+	if !legacy.Cid().Equals(expected.Stripped().Cid()) {
+		t.Fatalf("expected cid %s, got %s", expected.Stripped().Cid(), legacy.Cid())
+	}
+
+	if err := b.SetWitness(1, expected.Witnesses[1].Data...); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tx.RawData(), raw) {
+		t.Fatalf("expected %x, got %x", raw, tx.RawData())
+	}
+	if !tx.Cid().Equals(expected.Cid()) {
+		t.Fatalf("expected cid %s, got %s", expected.Cid(), tx.Cid())
+	}
+	if err := tx.VerifyInputs(b.PrevOuts(), ConsensusVerifyFlags); err != nil {
+		t.Fatal(err)
+	}
+
+	if vsize := b.VSize(); vsize != 261 {
+		t.Fatalf("expected vsize 261, got %d", vsize)
+	}
+	fee, err := b.Fee()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee != 1225000000-112340000-223450000 {
+		t.Fatalf("unexpected fee %d", fee)
+	}
+
+	// the built transaction does not change with the builder
+	b.SignalRBF()
+	if tx.Inputs[0].SeqNo != 0xffffffee || tx.Inputs[1].SeqNo != SequenceFinal {
+		t.Fatal("built transaction changed")
+	}
+
+	rbf, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rbf.Inputs[0].SeqNo != 0xffffffee || rbf.Inputs[1].SeqNo != SequenceMaxRBF {
+		t.Fatalf("unexpected sequence numbers %x, %x", rbf.Inputs[0].SeqNo, rbf.Inputs[1].SeqNo)
+	}
+}
+
+func TestTxBuilderErrors(t *testing.T) {
+	b := NewTxBuilder()
+	if _, err := b.Build(); err == nil {
+		t.Fatal("expected an error for a transaction without inputs")
+	}
+
+	b.AddInput(hashToCid(make([]byte, 32), cid.BitcoinTx), 0, nil)
+	if _, err := b.Build(); err == nil {
+		t.Fatal("expected an error for a transaction without outputs")
+	}
+
+	if _, err := b.AddAddressOutput("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", TestNet, 1000); !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("expected ErrInvalidAddress, got %v", err)
+	}
+	if _, err := b.AddAddressOutput("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", MainNet, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SetWitness(1, []byte{1}); err == nil {
+		t.Fatal("expected an error for an input out of range")
+	}
+	if _, err := b.Fee(); err == nil {
+		t.Fatal("expected an error for an input without its spent output")
+	}
+}
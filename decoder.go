@@ -0,0 +1,160 @@
+package ipldbtc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// maxMoney is the largest output value, in satoshis, a valid transaction may
+// carry (21 million bitcoin).
+const maxMoney = 21000000 * 100000000
+
+// DecodeNode decodes a bitcoin-block, bitcoin-tx or
+// bitcoin-witness-commitment IPLD block into a node.Node. The CID of the
+// block must use a double-sha256 multihash that matches its raw data.
+//
+// Blocks with the bitcoin-tx codec can hold either a transaction or an inner
+// node of the transaction merkle tree. A 64 byte block is only decoded as a
+// Tx if it is a complete, well formed transaction; otherwise it is decoded
+// as a TxTree.
+//
+// Transactions resolve their addresses for MainNet; see NewNodeDecoder.
+func DecodeNode(b blocks.Block) (node.Node, error) {
+	return decodeNode(b, decodeOptions{})
+}
+
+// NewNodeDecoder returns a decoder like DecodeNode that applies opts. Of the
+// options, only AddressNetwork concerns single nodes; it sets the Network of
+// the transactions decoded.
+func NewNodeDecoder(opts ...DecodeOption) node.DecodeBlockFunc {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(b blocks.Block) (node.Node, error) {
+		return decodeNode(b, o)
+	}
+}
+
+func decodeNode(b blocks.Block, o decodeOptions) (node.Node, error) {
+	c := b.Cid()
+	if err := checkHash(c, b.RawData()); err != nil {
+		return nil, err
+	}
+
+	switch c.Type() {
+	case cid.BitcoinBlock:
+		blk, err := DecodeBlock(b.RawData())
+		if err != nil {
+			return nil, err
+		}
+
+		if !blk.Cid().Equals(c) {
+			return nil, fmt.Errorf("block header does not match cid %s", c)
+		}
+		return blk, nil
+	case cid.BitcoinTx:
+		nd, err := decodeTxOrTree(b.RawData())
+		if err != nil {
+			return nil, err
+		}
+
+		if tx, ok := nd.(*Tx); ok {
+			tx.Network = o.network
+		}
+		return nd, nil
+	case BitcoinWitnessCommitment:
+		return DecodeWitnessCommitment(b.RawData())
+	default:
+		return nil, fmt.Errorf("unsupported codec for bitcoin decoder: %#x", c.Type())
+	}
+}
+
+// RegisterDecoders registers DecodeNode, or the decoder NewNodeDecoder
+// returns for opts, for the bitcoin-block, bitcoin-tx and
+// bitcoin-witness-commitment codecs with the given registry.
+func RegisterDecoders(r *node.Registry, opts ...DecodeOption) {
+	decode := NewNodeDecoder(opts...)
+	r.Register(cid.BitcoinBlock, decode)
+	r.Register(cid.BitcoinTx, decode)
+	r.Register(BitcoinWitnessCommitment, decode)
+}
+
+// checkHash verifies that c is a double-sha256 hash of data.
+func checkHash(c cid.Cid, data []byte) error {
+	dmh, err := mh.Decode(c.Hash())
+	if err != nil {
+		return fmt.Errorf("invalid multihash in cid %s: %s", c, err)
+	}
+
+	if dmh.Code != mh.DBL_SHA2_256 {
+		return fmt.Errorf("unsupported multihash for bitcoin data: %#x", dmh.Code)
+	}
+
+	sum, err := mh.Sum(data, mh.DBL_SHA2_256, -1)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(sum, c.Hash()) {
+		return fmt.Errorf("data does not match cid %s", c)
+	}
+
+	return nil
+}
+
+// decodeTxOrTree decodes b as a Tx or, if it is 64 bytes long and not a
+// well formed transaction, as a TxTree.
+func decodeTxOrTree(b []byte) (node.Node, error) {
+	tx, err := decodeStrictTx(b)
+	if len(b) != 64 {
+		if err != nil {
+			return nil, err
+		}
+		return tx, nil
+	}
+
+	if err == nil {
+		return tx, nil
+	}
+	return DecodeTxTree(b)
+}
+
+// decodeStrictTx decodes b as a transaction, requiring that it consumes all
+// of b and passes the context free consensus checks on its inputs and
+// outputs.
+func decodeStrictTx(b []byte) (*Tx, error) {
+	r := bufio.NewReader(bytes.NewReader(b))
+	tx, err := readTx(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.ReadByte(); err == nil {
+		return nil, fmt.Errorf("trailing data after transaction")
+	}
+
+	if len(tx.Inputs) == 0 {
+		return nil, fmt.Errorf("transaction has no inputs")
+	}
+
+	if len(tx.Outputs) == 0 {
+		return nil, fmt.Errorf("transaction has no outputs")
+	}
+
+	var total uint64
+	for _, out := range tx.Outputs {
+		total += out.Value
+		if out.Value > maxMoney || total > maxMoney {
+			return nil, fmt.Errorf("transaction output value out of range")
+		}
+	}
+
+	return tx, nil
+}
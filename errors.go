@@ -0,0 +1,237 @@
+package ipldbtc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+var (
+	// ErrNonCanonicalVarint is the cause of a DecodeError for a compact size
+	// integer not encoded in its shortest form.
+	ErrNonCanonicalVarint = errors.New("non-canonical compact size")
+
+	// ErrOversize is the cause of a DecodeError for a count or length larger
+	// than any valid block could hold.
+	ErrOversize = errors.New("count or length too large")
+
+	// ErrSuperfluousWitness is the cause of a DecodeError for a transaction
+	// in the witness serialization whose witnesses are all empty, which
+	// would not serialize back to the same bytes.
+	ErrSuperfluousWitness = errors.New("superfluous witness record")
+
+	// ErrMerkleRootMismatch is returned when the transactions of a block do
+	// not hash to the merkle root in its header.
+	ErrMerkleRootMismatch = errors.New("merkle root mismatch")
+
+	// ErrMutatedMerkleTree is returned for a block whose transaction list
+	// repeats its tail so that it hashes to the same merkle root as the
+	// block it was copied from (CVE-2012-2459).
+	ErrMutatedMerkleTree = errors.New("mutated merkle tree: duplicate transactions")
+
+	// ErrInvalidTarget is returned for a header whose compact target is
+	// zero, negative or overflows 256 bits.
+	ErrInvalidTarget = errors.New("invalid proof of work target")
+
+	// ErrProofOfWork is returned for a header whose hash is above its
+	// target.
+	ErrProofOfWork = errors.New("insufficient proof of work")
+
+	// ErrInvalidProof is returned for an inclusion proof that does not lead
+	// to the expected merkle root.
+	ErrInvalidProof = errors.New("invalid inclusion proof")
+
+	// ErrInvalidMerkleBlock is returned for a merkleblock message whose
+	// partial merkle tree is malformed.
+	ErrInvalidMerkleBlock = errors.New("invalid merkleblock")
+
+	// ErrMalformedPush is returned for a script ending in a push of more
+	// data than the script holds.
+	ErrMalformedPush = errors.New("malformed script push")
+
+	// ErrNoAddress is returned for an output script that has no address
+	// form, such as OP_RETURN or bare multisig outputs.
+	ErrNoAddress = errors.New("script has no address")
+
+	// ErrInvalidAddress is returned for an address that is malformed or
+	// belongs to another network.
+	ErrInvalidAddress = errors.New("invalid address")
+
+	// ErrInvalidPsbt is returned for a PSBT that is malformed or cannot be
+	// used for the operation requested.
+	ErrInvalidPsbt = errors.New("invalid psbt")
+
+	// ErrScriptVerify is the cause of a ScriptError, returned for a
+	// transaction input that does not validly spend its output.
+	ErrScriptVerify = errors.New("script verification failed")
+
+	// ErrPrevOutsRequired is returned by VerifyInput for a taproot
+	// signature that commits to every output spent by the transaction, when
+	// only the output spent by the input is known.
+	ErrPrevOutsRequired = errors.New("taproot signature commits to every spent output")
+)
+
+// DecodeError describes a failure to decode a block, transaction or one of
+// their fields. Truncated input is reported with io.ErrUnexpectedEOF as the
+// cause.
+type DecodeError struct {
+	// Field names the field being decoded, such as "tx_in[2].script".
+	Field string
+
+	// Offset is the position of the field from the start of the input.
+	Offset int64
+
+	// TxIndex is the index of the transaction within its block, or -1 if
+	// the failure is not within a transaction of a block.
+	TxIndex int
+
+	// Err is the underlying cause.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.TxIndex >= 0 {
+		return fmt.Sprintf("failed to decode tx %d %s at offset %d: %s", e.TxIndex, e.Field, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("failed to decode %s at offset %d: %s", e.Field, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// RoundTripError reports a node of a block that does not re-serialize to
+// the bytes it was decoded from.
+type RoundTripError struct {
+	// Node is the kind of node: "header", "tx" or "tx_tree".
+	Node string
+
+	// Index is the position of the transaction in the block, or of the tree
+	// node among the TxTree nodes returned by DecodeBlockMessage.
+	Index int
+
+	// Offset is the position of the node in the input, or -1 for tree nodes
+	// which are not part of the serialized block.
+	Offset int64
+
+	Cid cid.Cid
+}
+
+func (e *RoundTripError) Error() string {
+	if e.Node == "header" {
+		return fmt.Sprintf("header %s does not re-serialize to its input", e.Cid)
+	}
+	return fmt.Sprintf("%s %d (%s) does not re-serialize to its input", e.Node, e.Index, e.Cid)
+}
+
+// ScriptErrorCode names the reason a script failed to verify, using the
+// names of the script errors of Bitcoin Core.
+type ScriptErrorCode string
+
+const (
+	ScriptErrUnknown                            ScriptErrorCode = "UNKNOWN_ERROR"
+	ScriptErrEvalFalse                          ScriptErrorCode = "EVAL_FALSE"
+	ScriptErrOpReturn                           ScriptErrorCode = "OP_RETURN"
+	ScriptErrScriptSize                         ScriptErrorCode = "SCRIPT_SIZE"
+	ScriptErrPushSize                           ScriptErrorCode = "PUSH_SIZE"
+	ScriptErrOpCount                            ScriptErrorCode = "OP_COUNT"
+	ScriptErrStackSize                          ScriptErrorCode = "STACK_SIZE"
+	ScriptErrSigCount                           ScriptErrorCode = "SIG_COUNT"
+	ScriptErrPubKeyCount                        ScriptErrorCode = "PUBKEY_COUNT"
+	ScriptErrVerify                             ScriptErrorCode = "VERIFY"
+	ScriptErrEqualVerify                        ScriptErrorCode = "EQUALVERIFY"
+	ScriptErrCheckMultiSigVerify                ScriptErrorCode = "CHECKMULTISIGVERIFY"
+	ScriptErrCheckSigVerify                     ScriptErrorCode = "CHECKSIGVERIFY"
+	ScriptErrNumEqualVerify                     ScriptErrorCode = "NUMEQUALVERIFY"
+	ScriptErrBadOpcode                          ScriptErrorCode = "BAD_OPCODE"
+	ScriptErrDisabledOpcode                     ScriptErrorCode = "DISABLED_OPCODE"
+	ScriptErrInvalidStackOperation              ScriptErrorCode = "INVALID_STACK_OPERATION"
+	ScriptErrInvalidAltStackOperation           ScriptErrorCode = "INVALID_ALTSTACK_OPERATION"
+	ScriptErrUnbalancedConditional              ScriptErrorCode = "UNBALANCED_CONDITIONAL"
+	ScriptErrNegativeLockTime                   ScriptErrorCode = "NEGATIVE_LOCKTIME"
+	ScriptErrUnsatisfiedLockTime                ScriptErrorCode = "UNSATISFIED_LOCKTIME"
+	ScriptErrSigHashType                        ScriptErrorCode = "SIG_HASHTYPE"
+	ScriptErrSigDER                             ScriptErrorCode = "SIG_DER"
+	ScriptErrMinimalData                        ScriptErrorCode = "MINIMALDATA"
+	ScriptErrSigPushOnly                        ScriptErrorCode = "SIG_PUSHONLY"
+	ScriptErrSigHighS                           ScriptErrorCode = "SIG_HIGH_S"
+	ScriptErrSigNullDummy                       ScriptErrorCode = "SIG_NULLDUMMY"
+	ScriptErrPubKeyType                         ScriptErrorCode = "PUBKEYTYPE"
+	ScriptErrCleanStack                         ScriptErrorCode = "CLEANSTACK"
+	ScriptErrMinimalIf                          ScriptErrorCode = "MINIMALIF"
+	ScriptErrNullFail                           ScriptErrorCode = "NULLFAIL"
+	ScriptErrDiscourageUpgradableNops           ScriptErrorCode = "DISCOURAGE_UPGRADABLE_NOPS"
+	ScriptErrDiscourageUpgradableWitnessProgram ScriptErrorCode = "DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM"
+	ScriptErrDiscourageUpgradableTaprootVersion ScriptErrorCode = "DISCOURAGE_UPGRADABLE_TAPROOT_VERSION"
+	ScriptErrDiscourageOpSuccess                ScriptErrorCode = "DISCOURAGE_OP_SUCCESS"
+	ScriptErrDiscourageUpgradablePubKeyType     ScriptErrorCode = "DISCOURAGE_UPGRADABLE_PUBKEYTYPE"
+	ScriptErrWitnessProgramWrongLength          ScriptErrorCode = "WITNESS_PROGRAM_WRONG_LENGTH"
+	ScriptErrWitnessProgramWitnessEmpty         ScriptErrorCode = "WITNESS_PROGRAM_WITNESS_EMPTY"
+	ScriptErrWitnessProgramMismatch             ScriptErrorCode = "WITNESS_PROGRAM_MISMATCH"
+	ScriptErrWitnessMalleated                   ScriptErrorCode = "WITNESS_MALLEATED"
+	ScriptErrWitnessMalleatedP2SH               ScriptErrorCode = "WITNESS_MALLEATED_P2SH"
+	ScriptErrWitnessUnexpected                  ScriptErrorCode = "WITNESS_UNEXPECTED"
+	ScriptErrWitnessPubKeyType                  ScriptErrorCode = "WITNESS_PUBKEYTYPE"
+	ScriptErrSchnorrSigSize                     ScriptErrorCode = "SCHNORR_SIG_SIZE"
+	ScriptErrSchnorrSigHashType                 ScriptErrorCode = "SCHNORR_SIG_HASHTYPE"
+	ScriptErrSchnorrSig                         ScriptErrorCode = "SCHNORR_SIG"
+	ScriptErrTaprootWrongControlSize            ScriptErrorCode = "TAPROOT_WRONG_CONTROL_SIZE"
+	ScriptErrTapscriptValidationWeight          ScriptErrorCode = "TAPSCRIPT_VALIDATION_WEIGHT"
+	ScriptErrTapscriptCheckMultiSig             ScriptErrorCode = "TAPSCRIPT_CHECKMULTISIG"
+	ScriptErrTapscriptMinimalIf                 ScriptErrorCode = "TAPSCRIPT_MINIMALIF"
+	ScriptErrOpCodeSeparator                    ScriptErrorCode = "OP_CODESEPARATOR"
+	ScriptErrSigFindAndDelete                   ScriptErrorCode = "SIG_FINDANDDELETE"
+)
+
+// ScriptError is returned for a transaction input that fails script
+// verification. Its cause is ErrScriptVerify.
+type ScriptError struct {
+	Code ScriptErrorCode
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrScriptVerify, e.Code)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return ErrScriptVerify
+}
+
+func scriptError(code ScriptErrorCode) error {
+	return &ScriptError{Code: code}
+}
+
+// newDecodeError returns a DecodeError for field starting at off. A short
+// read is reported as io.ErrUnexpectedEOF.
+func newDecodeError(field string, off int64, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return &DecodeError{
+		Field:   field,
+		Offset:  off,
+		TxIndex: -1,
+		Err:     err,
+	}
+}
+
+// prefixField prepends prefix to the field of err if it is a DecodeError.
+func prefixField(err error, prefix string) error {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		de.Field = prefix + de.Field
+	}
+	return err
+}
+
+// withTxIndex records the transaction index in err if it is a DecodeError.
+func withTxIndex(err error, i int) error {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		de.TxIndex = i
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+)
+
+// FullBlock is a block header together with its transactions and the
+// serialized block they were decoded from. As a node it is the Block: its
+// Cid and RawData are those of the header, and it resolves as the header
+// does. Its Size and Stat, however, report the whole serialized block, as
+// returned by BlockData.
+type FullBlock struct {
+	*Block
+	Transactions []*Tx
+
+	rawdata []byte
+}
+
+// assert that FullBlock matches the Node interface for ipld
+var _ node.Node = (*FullBlock)(nil)
+
+// DecodeFullBlock decodes a serialized block as DecodeBlockMessage does,
+// keeping a copy of b.
+func DecodeFullBlock(b []byte, opts ...DecodeOption) (*FullBlock, error) {
+	nodes, err := DecodeBlockMessage(b, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	fb := &FullBlock{
+		Block:   nodes[0].(*Block),
+		rawdata: append([]byte(nil), b...),
+	}
+	// the transactions come right after the header, and are followed by
+	// the merkle trees and the Stripped forms of segwit transactions
+	for _, nd := range nodes[1:] {
+		tx, ok := nd.(*Tx)
+		if !ok {
+			break
+		}
+		fb.Transactions = append(fb.Transactions, tx)
+	}
+	return fb, nil
+}
+
+// NewFullBlock assembles a block from its header and transactions. The
+// transactions are not checked against the merkle root. The nodes fetched by
+// following the merkle tree of blk are Stripped, so they give a block
+// without witness data.
+func NewFullBlock(blk *Block, txs []*Tx) *FullBlock {
+	nb := *blk
+	leaves := make([]cid.Cid, len(txs))
+	for i, tx := range txs {
+		leaves[i] = tx.Stripped().Cid()
+	}
+	trees, root, _ := mkMerkleTree(leaves)
+	nb.txSize = setTxTreeSizes(txs, leaves, trees, root)
+
+	fb := &FullBlock{Block: &nb, Transactions: txs}
+	buf := new(bytes.Buffer)
+	fb.WriteTo(buf)
+	fb.rawdata = buf.Bytes()
+	return fb
+}
+
+// BlockData returns the serialized block, as it was decoded.
+func (fb *FullBlock) BlockData() []byte {
+	return fb.rawdata
+}
+
+// WriteTo writes the wire format block message: the header, the number of
+// transactions and the transactions.
+func (fb *FullBlock) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	n, err := w.Write(fb.header())
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	n, err = writeVarInt(w, uint64(len(fb.Transactions)))
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	for _, tx := range fb.Transactions {
+		n, err = w.Write(tx.RawData())
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Size returns the size of the serialized block.
+func (fb *FullBlock) Size() (uint64, error) {
+	return uint64(len(fb.rawdata)), nil
+}
+
+// Stat reports the size of the serialized block as BlockSize and DataSize.
+// The cumulative size is that of the Block: the header, its merkle tree and
+// the transactions stored as nodes.
+func (fb *FullBlock) Stat() (*node.NodeStat, error) {
+	st, err := fb.Block.Stat()
+	if err != nil {
+		return nil, err
+	}
+	st.BlockSize = len(fb.rawdata)
+	st.DataSize = len(fb.rawdata)
+	return st, nil
+}
+
+func (fb *FullBlock) Copy() node.Node {
+	nb := *fb.Block
+	return &FullBlock{
+		Block:        &nb,
+		Transactions: append([]*Tx(nil), fb.Transactions...),
+		rawdata:      append([]byte(nil), fb.rawdata...),
+	}
+}
+
+func (fb *FullBlock) String() string {
+	return "[bitcoin full block]"
+}
@@ -0,0 +1,58 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFullBlock(t *testing.T) {
+	for _, name := range []string{"block.hex", "segwit.hex"} {
+		data := loadFixture(t, name)
+		fb, err := DecodeFullBlock(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size, _ := fb.Size(); size != uint64(len(data)) {
+			t.Fatalf("%s: expected size %d, got %d", name, len(data), size)
+		}
+		if size, _ := fb.Block.Size(); size != 80 {
+			t.Fatalf("%s: expected header size 80, got %d", name, size)
+		}
+		if !bytes.Equal(fb.BlockData(), data) || !bytes.Equal(fb.RawData(), data[:80]) {
+			t.Fatalf("%s: unexpected data", name)
+		}
+
+		buf := new(bytes.Buffer)
+		n, err := fb.WriteTo(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("%s: block message does not round trip", name)
+		}
+
+		if fb.Weight() != 3*fb.StrippedSize()+fb.TotalSize() || fb.TotalSize() != int64(len(data)) {
+			t.Fatalf("%s: unexpected weight %d", name, fb.Weight())
+		}
+
+		// reassembling the block from its nodes gives the same block
+		nb := NewFullBlock(fb.Block, fb.Transactions)
+		if !bytes.Equal(nb.BlockData(), data) || !nb.Cid().Equals(fb.Cid()) {
+			t.Fatalf("%s: reassembled block differs", name)
+		}
+		st, _ := fb.Stat()
+		nst, _ := nb.Stat()
+		hst, _ := fb.Block.Stat()
+		if *st != *nst || st.BlockSize != len(data) || st.Hash != fb.Cid().String() || st.CumulativeSize != hst.CumulativeSize {
+			t.Fatalf("%s: unexpected stat %s, reassembled %s", name, st, nst)
+		}
+
+		cp := fb.Copy().(*FullBlock)
+		cp.Transactions = nil
+		cp.Nonce++
+		if len(fb.Transactions) == 0 || !fb.Cid().Equals(nb.Cid()) {
+			t.Fatalf("%s: copy is not independent", name)
+		}
+	}
+}
@@ -0,0 +1,959 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	maxScriptSize         = 10000
+	maxScriptElementSize  = 520
+	maxOpsPerScript       = 201
+	maxPubKeysPerMultiSig = 20
+	maxStackSize          = 1000
+
+	// maxScriptNumSize is the largest number of bytes of a number operand;
+	// locktimes allow 5.
+	maxScriptNumSize   = 4
+	maxLockTimeNumSize = 5
+
+	// validationWeightPerSigOp is the tapscript budget taken by each
+	// signature check, and validationWeightOffset the budget granted on top
+	// of the witness size (BIP342).
+	validationWeightPerSigOp = 50
+	validationWeightOffset   = 50
+
+	lockTimeThreshold        = 500000000
+	sequenceLockTimeDisabled = 1 << 31
+	sequenceLockTimeTypeFlag = 1 << 22
+	sequenceLockTimeMask     = 0x0000ffff
+)
+
+// sigVersion is the set of rules scripts are executed under.
+type sigVersion int
+
+const (
+	sigVersionBase sigVersion = iota
+	sigVersionWitnessV0
+	sigVersionTaproot
+	sigVersionTapscript
+)
+
+// engine holds the state of verifying one input of a transaction.
+type engine struct {
+	tx       *Tx
+	index    int
+	prevOuts []*TxOut
+	flags    VerifyFlags
+
+	// taproot execution data
+	annex       []byte
+	tapLeafHash []byte
+	codeSepPos  uint32
+	weightLeft  int64
+}
+
+// scriptStack is the main or alt stack of the interpreter, with its top at
+// the end.
+type scriptStack [][]byte
+
+func (s *scriptStack) push(v []byte) {
+	*s = append(*s, v)
+}
+
+func (s *scriptStack) pop() []byte {
+	v := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return v
+}
+
+// top returns the item i from the top, counting from -1 as in Bitcoin Core.
+func (s scriptStack) top(i int) []byte {
+	return s[len(s)+i]
+}
+
+// remove deletes the item i from the top.
+func (s *scriptStack) remove(i int) {
+	n := len(*s) + i
+	*s = append((*s)[:n], (*s)[n+1:]...)
+}
+
+// num returns the item i from the top as a number.
+func (s scriptStack) num(i int, minimal bool, maxSize int) (int64, error) {
+	return parseScriptNum(s.top(i), minimal, maxSize)
+}
+
+// eval executes script on stack, following EvalScript of Bitcoin Core.
+func (e *engine) eval(stack *scriptStack, script Script, sv sigVersion) error {
+	if (sv == sigVersionBase || sv == sigVersionWitnessV0) && len(script) > maxScriptSize {
+		return scriptError(ScriptErrScriptSize)
+	}
+
+	var alt scriptStack
+	var cond []bool
+	opCount := 0
+	minimal := e.flags&VerifyMinimalData != 0
+
+	// signatures commit to the script following the last executed
+	// OP_CODESEPARATOR
+	codeStart := 0
+	e.codeSepPos = 0xffffffff
+
+	for pc, opPos := 0, uint32(0); pc < len(script); opPos++ {
+		op, n, err := script.opAt(pc)
+		if err != nil {
+			return scriptError(ScriptErrBadOpcode)
+		}
+		pc += n
+
+		exec := true
+		for _, c := range cond {
+			exec = exec && c
+		}
+
+		if len(op.Data) > maxScriptElementSize {
+			return scriptError(ScriptErrPushSize)
+		}
+
+		if sv == sigVersionBase || sv == sigVersionWitnessV0 {
+			if op.Opcode > Op16 {
+				opCount++
+				if opCount > maxOpsPerScript {
+					return scriptError(ScriptErrOpCount)
+				}
+			}
+		}
+
+		switch op.Opcode {
+		case OpCat, OpSubStr, OpLeft, OpRight, OpInvert, OpAnd, OpOr, OpXor,
+			Op2Mul, Op2Div, OpMul, OpDiv, OpMod, OpLShift, OpRShift:
+			// disabled even when not executed
+			return scriptError(ScriptErrDisabledOpcode)
+		}
+
+		if op.Opcode == OpCodeSeparator && sv == sigVersionBase && e.flags&VerifyConstScriptCode != 0 {
+			return scriptError(ScriptErrOpCodeSeparator)
+		}
+
+		switch {
+		case !exec && (op.Opcode < OpIf || op.Opcode > OpEndIf):
+			// skipped by a conditional
+
+		case op.Opcode <= OpPushData4:
+			if minimal && !isMinimalPush(op) {
+				return scriptError(ScriptErrMinimalData)
+			}
+			stack.push(op.Data)
+
+		case op.Opcode == Op1Negate || (op.Opcode >= OpTrue && op.Opcode <= Op16):
+			stack.push(scriptNumBytes(int64(op.Opcode) - int64(OpTrue-1)))
+
+		default:
+			switch op.Opcode {
+			case OpNop:
+
+			case OpCheckLockTimeVerify:
+				if e.flags&VerifyCheckLockTimeVerify == 0 {
+					// not enabled, treated as a NOP2
+					break
+				}
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				lockTime, err := stack.num(-1, minimal, maxLockTimeNumSize)
+				if err != nil {
+					return err
+				}
+				if lockTime < 0 {
+					return scriptError(ScriptErrNegativeLockTime)
+				}
+				if !e.checkLockTime(lockTime) {
+					return scriptError(ScriptErrUnsatisfiedLockTime)
+				}
+
+			case OpCheckSequenceVerify:
+				if e.flags&VerifyCheckSequenceVerify == 0 {
+					// not enabled, treated as a NOP3
+					break
+				}
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				sequence, err := stack.num(-1, minimal, maxLockTimeNumSize)
+				if err != nil {
+					return err
+				}
+				if sequence < 0 {
+					return scriptError(ScriptErrNegativeLockTime)
+				}
+				if sequence&sequenceLockTimeDisabled != 0 {
+					break
+				}
+				if !e.checkSequence(sequence) {
+					return scriptError(ScriptErrUnsatisfiedLockTime)
+				}
+
+			case OpNop1, OpNop4, OpNop5, OpNop6, OpNop7, OpNop8, OpNop9, OpNop10:
+				if e.flags&VerifyDiscourageUpgradableNops != 0 {
+					return scriptError(ScriptErrDiscourageUpgradableNops)
+				}
+
+			case OpIf, OpNotIf:
+				value := false
+				if exec {
+					if len(*stack) < 1 {
+						return scriptError(ScriptErrUnbalancedConditional)
+					}
+					v := stack.top(-1)
+					if sv == sigVersionTapscript || (sv == sigVersionWitnessV0 && e.flags&VerifyMinimalIf != 0) {
+						if len(v) > 1 || (len(v) == 1 && v[0] != 1) {
+							if sv == sigVersionTapscript {
+								return scriptError(ScriptErrTapscriptMinimalIf)
+							}
+							return scriptError(ScriptErrMinimalIf)
+						}
+					}
+					value = castToBool(v)
+					if op.Opcode == OpNotIf {
+						value = !value
+					}
+					stack.pop()
+				}
+				cond = append(cond, value)
+
+			case OpElse:
+				if len(cond) == 0 {
+					return scriptError(ScriptErrUnbalancedConditional)
+				}
+				cond[len(cond)-1] = !cond[len(cond)-1]
+
+			case OpEndIf:
+				if len(cond) == 0 {
+					return scriptError(ScriptErrUnbalancedConditional)
+				}
+				cond = cond[:len(cond)-1]
+
+			case OpVerify:
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				if !castToBool(stack.top(-1)) {
+					return scriptError(ScriptErrVerify)
+				}
+				stack.pop()
+
+			case OpReturn:
+				return scriptError(ScriptErrOpReturn)
+
+			case OpToAltStack:
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				alt.push(stack.pop())
+
+			case OpFromAltStack:
+				if len(alt) < 1 {
+					return scriptError(ScriptErrInvalidAltStackOperation)
+				}
+				stack.push(alt.pop())
+
+			case Op2Drop:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				stack.pop()
+				stack.pop()
+
+			case Op2Dup:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				a, b := stack.top(-2), stack.top(-1)
+				stack.push(a)
+				stack.push(b)
+
+			case Op3Dup:
+				if len(*stack) < 3 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				a, b, c := stack.top(-3), stack.top(-2), stack.top(-1)
+				stack.push(a)
+				stack.push(b)
+				stack.push(c)
+
+			case Op2Over:
+				if len(*stack) < 4 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				a, b := stack.top(-4), stack.top(-3)
+				stack.push(a)
+				stack.push(b)
+
+			case Op2Rot:
+				if len(*stack) < 6 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				a, b := stack.top(-6), stack.top(-5)
+				stack.remove(-6)
+				stack.remove(-5)
+				stack.push(a)
+				stack.push(b)
+
+			case Op2Swap:
+				if len(*stack) < 4 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				s := *stack
+				n := len(s)
+				s[n-4], s[n-2] = s[n-2], s[n-4]
+				s[n-3], s[n-1] = s[n-1], s[n-3]
+
+			case OpIfDup:
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				if v := stack.top(-1); castToBool(v) {
+					stack.push(v)
+				}
+
+			case OpDepth:
+				stack.push(scriptNumBytes(int64(len(*stack))))
+
+			case OpDrop:
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				stack.pop()
+
+			case OpDup:
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				stack.push(stack.top(-1))
+
+			case OpNip:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				stack.remove(-2)
+
+			case OpOver:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				stack.push(stack.top(-2))
+
+			case OpPick, OpRoll:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				n, err := stack.num(-1, minimal, maxScriptNumSize)
+				if err != nil {
+					return err
+				}
+				stack.pop()
+				if n < 0 || n >= int64(len(*stack)) {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				v := stack.top(-int(n) - 1)
+				if op.Opcode == OpRoll {
+					stack.remove(-int(n) - 1)
+				}
+				stack.push(v)
+
+			case OpRot:
+				if len(*stack) < 3 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				s := *stack
+				n := len(s)
+				s[n-3], s[n-2], s[n-1] = s[n-2], s[n-1], s[n-3]
+
+			case OpSwap:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				s := *stack
+				n := len(s)
+				s[n-2], s[n-1] = s[n-1], s[n-2]
+
+			case OpTuck:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				v := stack.top(-1)
+				n := len(*stack)
+				*stack = append((*stack)[:n-2], v, (*stack)[n-2], (*stack)[n-1])
+
+			case OpSize:
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				stack.push(scriptNumBytes(int64(len(stack.top(-1)))))
+
+			case OpEqual, OpEqualVerify:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				equal := bytes.Equal(stack.pop(), stack.pop())
+				stack.push(boolBytes(equal))
+				if op.Opcode == OpEqualVerify {
+					if !equal {
+						return scriptError(ScriptErrEqualVerify)
+					}
+					stack.pop()
+				}
+
+			case Op1Add, Op1Sub, OpNegate, OpAbs, OpNot, Op0NotEqual:
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				n, err := stack.num(-1, minimal, maxScriptNumSize)
+				if err != nil {
+					return err
+				}
+				switch op.Opcode {
+				case Op1Add:
+					n++
+				case Op1Sub:
+					n--
+				case OpNegate:
+					n = -n
+				case OpAbs:
+					if n < 0 {
+						n = -n
+					}
+				case OpNot:
+					n = boolNum(n == 0)
+				case Op0NotEqual:
+					n = boolNum(n != 0)
+				}
+				stack.pop()
+				stack.push(scriptNumBytes(n))
+
+			case OpAdd, OpSub, OpBoolAnd, OpBoolOr, OpNumEqual, OpNumEqualVerify, OpNumNotEqual,
+				OpLessThan, OpGreaterThan, OpLessThanOrEqual, OpGreaterThanOrEqual, OpMin, OpMax:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				a, err := stack.num(-2, minimal, maxScriptNumSize)
+				if err != nil {
+					return err
+				}
+				b, err := stack.num(-1, minimal, maxScriptNumSize)
+				if err != nil {
+					return err
+				}
+
+				var n int64
+				switch op.Opcode {
+				case OpAdd:
+					n = a + b
+				case OpSub:
+					n = a - b
+				case OpBoolAnd:
+					n = boolNum(a != 0 && b != 0)
+				case OpBoolOr:
+					n = boolNum(a != 0 || b != 0)
+				case OpNumEqual, OpNumEqualVerify:
+					n = boolNum(a == b)
+				case OpNumNotEqual:
+					n = boolNum(a != b)
+				case OpLessThan:
+					n = boolNum(a < b)
+				case OpGreaterThan:
+					n = boolNum(a > b)
+				case OpLessThanOrEqual:
+					n = boolNum(a <= b)
+				case OpGreaterThanOrEqual:
+					n = boolNum(a >= b)
+				case OpMin:
+					n = min(a, b)
+				case OpMax:
+					n = max(a, b)
+				}
+				stack.pop()
+				stack.pop()
+				stack.push(scriptNumBytes(n))
+
+				if op.Opcode == OpNumEqualVerify {
+					if n == 0 {
+						return scriptError(ScriptErrNumEqualVerify)
+					}
+					stack.pop()
+				}
+
+			case OpWithin:
+				if len(*stack) < 3 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				var nums [3]int64
+				for i := range nums {
+					n, err := stack.num(i-3, minimal, maxScriptNumSize)
+					if err != nil {
+						return err
+					}
+					nums[i] = n
+				}
+				stack.pop()
+				stack.pop()
+				stack.pop()
+				stack.push(boolBytes(nums[1] <= nums[0] && nums[0] < nums[2]))
+
+			case OpRipemd160, OpSha1, OpSha256, OpHash160, OpHash256:
+				if len(*stack) < 1 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				v := stack.pop()
+				switch op.Opcode {
+				case OpRipemd160:
+					h := ripemd160.New()
+					h.Write(v)
+					stack.push(h.Sum(nil))
+				case OpSha1:
+					sum := sha1.Sum(v)
+					stack.push(sum[:])
+				case OpSha256:
+					sum := sha256.Sum256(v)
+					stack.push(sum[:])
+				case OpHash160:
+					stack.push(hash160(v))
+				case OpHash256:
+					stack.push(dsha256(v))
+				}
+
+			case OpCodeSeparator:
+				codeStart = pc
+				e.codeSepPos = opPos
+
+			case OpCheckSig, OpCheckSigVerify:
+				if len(*stack) < 2 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				sig, pubKey := stack.top(-2), stack.top(-1)
+				ok, err := e.evalCheckSig(sig, pubKey, script[codeStart:], sv)
+				if err != nil {
+					return err
+				}
+				stack.pop()
+				stack.pop()
+				stack.push(boolBytes(ok))
+				if op.Opcode == OpCheckSigVerify {
+					if !ok {
+						return scriptError(ScriptErrCheckSigVerify)
+					}
+					stack.pop()
+				}
+
+			case OpCheckSigAdd:
+				if sv == sigVersionBase || sv == sigVersionWitnessV0 {
+					return scriptError(ScriptErrBadOpcode)
+				}
+				if len(*stack) < 3 {
+					return scriptError(ScriptErrInvalidStackOperation)
+				}
+				sig, pubKey := stack.top(-3), stack.top(-1)
+				n, err := stack.num(-2, minimal, maxScriptNumSize)
+				if err != nil {
+					return err
+				}
+				ok, err := e.evalCheckSig(sig, pubKey, nil, sv)
+				if err != nil {
+					return err
+				}
+				stack.pop()
+				stack.pop()
+				stack.pop()
+				stack.push(scriptNumBytes(n + boolNum(ok)))
+
+			case OpCheckMultiSig, OpCheckMultiSigVerify:
+				if sv == sigVersionTapscript {
+					return scriptError(ScriptErrTapscriptCheckMultiSig)
+				}
+				ok, err := e.evalCheckMultiSig(stack, script[codeStart:], sv, &opCount)
+				if err != nil {
+					return err
+				}
+				stack.push(boolBytes(ok))
+				if op.Opcode == OpCheckMultiSigVerify {
+					if !ok {
+						return scriptError(ScriptErrCheckMultiSigVerify)
+					}
+					stack.pop()
+				}
+
+			default:
+				return scriptError(ScriptErrBadOpcode)
+			}
+		}
+
+		if len(*stack)+len(alt) > maxStackSize {
+			return scriptError(ScriptErrStackSize)
+		}
+	}
+
+	if len(cond) != 0 {
+		return scriptError(ScriptErrUnbalancedConditional)
+	}
+	return nil
+}
+
+// evalCheckSig checks a signature for OP_CHECKSIG and its variants. A
+// failed check only returns an error where the rules require the script to
+// fail rather than push false.
+func (e *engine) evalCheckSig(sig, pubKey []byte, scriptCode Script, sv sigVersion) (bool, error) {
+	if sv == sigVersionTapscript {
+		return e.evalCheckSigTapscript(sig, pubKey)
+	}
+
+	if sv == sigVersionBase {
+		var found bool
+		scriptCode, found = findAndDelete(scriptCode, pushScript(sig))
+		if found && e.flags&VerifyConstScriptCode != 0 {
+			return false, scriptError(ScriptErrSigFindAndDelete)
+		}
+	}
+
+	if err := e.checkSignatureEncoding(sig); err != nil {
+		return false, err
+	}
+	if err := e.checkPubKeyEncoding(pubKey, sv); err != nil {
+		return false, err
+	}
+
+	ok, err := e.checkECDSA(sig, pubKey, scriptCode, sv)
+	if err != nil {
+		return false, err
+	}
+	if !ok && e.flags&VerifyNullFail != 0 && len(sig) != 0 {
+		return false, scriptError(ScriptErrNullFail)
+	}
+	return ok, nil
+}
+
+func (e *engine) evalCheckSigTapscript(sig, pubKey []byte) (bool, error) {
+	// an empty signature fails the check without using any budget
+	ok := len(sig) != 0
+	if ok {
+		e.weightLeft -= validationWeightPerSigOp
+		if e.weightLeft < 0 {
+			return false, scriptError(ScriptErrTapscriptValidationWeight)
+		}
+	}
+
+	switch len(pubKey) {
+	case 0:
+		return false, scriptError(ScriptErrPubKeyType)
+	case 32:
+		if ok {
+			if err := e.checkSchnorr(sig, pubKey, sigVersionTapscript); err != nil {
+				return false, err
+			}
+		}
+	default:
+		// unknown public key types are left for future soft forks
+		if e.flags&VerifyDiscourageUpgradablePubKeyType != 0 {
+			return false, scriptError(ScriptErrDiscourageUpgradablePubKeyType)
+		}
+	}
+	return ok, nil
+}
+
+// evalCheckMultiSig runs OP_CHECKMULTISIG, popping its operands including
+// the extra dummy item.
+func (e *engine) evalCheckMultiSig(stack *scriptStack, scriptCode Script, sv sigVersion, opCount *int) (bool, error) {
+	minimal := e.flags&VerifyMinimalData != 0
+
+	i := 1
+	if len(*stack) < i {
+		return false, scriptError(ScriptErrInvalidStackOperation)
+	}
+
+	nKeys, err := stack.num(-i, minimal, maxScriptNumSize)
+	if err != nil {
+		return false, err
+	}
+	if nKeys < 0 || nKeys > maxPubKeysPerMultiSig {
+		return false, scriptError(ScriptErrPubKeyCount)
+	}
+	*opCount += int(nKeys)
+	if *opCount > maxOpsPerScript {
+		return false, scriptError(ScriptErrOpCount)
+	}
+
+	i++
+	iKey := i
+	// iKey2 is the position of the last key to be checked for NULLFAIL
+	iKey2 := int(nKeys) + 2
+	i += int(nKeys)
+	if len(*stack) < i {
+		return false, scriptError(ScriptErrInvalidStackOperation)
+	}
+
+	nSigs, err := stack.num(-i, minimal, maxScriptNumSize)
+	if err != nil {
+		return false, err
+	}
+	if nSigs < 0 || nSigs > nKeys {
+		return false, scriptError(ScriptErrSigCount)
+	}
+
+	i++
+	iSig := i
+	i += int(nSigs)
+	if len(*stack) < i {
+		return false, scriptError(ScriptErrInvalidStackOperation)
+	}
+
+	// signatures cannot sign themselves
+	if sv == sigVersionBase {
+		for k := 0; k < int(nSigs); k++ {
+			var found bool
+			scriptCode, found = findAndDelete(scriptCode, pushScript(stack.top(-iSig-k)))
+			if found && e.flags&VerifyConstScriptCode != 0 {
+				return false, scriptError(ScriptErrSigFindAndDelete)
+			}
+		}
+	}
+
+	ok := true
+	for ok && nSigs > 0 {
+		sig, pubKey := stack.top(-iSig), stack.top(-iKey)
+
+		if err := e.checkSignatureEncoding(sig); err != nil {
+			return false, err
+		}
+		if err := e.checkPubKeyEncoding(pubKey, sv); err != nil {
+			return false, err
+		}
+
+		match, err := e.checkECDSA(sig, pubKey, scriptCode, sv)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			iSig++
+			nSigs--
+		}
+		iKey++
+		nKeys--
+
+		// more signatures left than keys means failure
+		if nSigs > nKeys {
+			ok = false
+		}
+	}
+
+	// pop the operands, checking NULLFAIL for the signatures
+	for ; i > 1; i-- {
+		if !ok && e.flags&VerifyNullFail != 0 && iKey2 == 0 && len(stack.top(-1)) != 0 {
+			return false, scriptError(ScriptErrNullFail)
+		}
+		if iKey2 > 0 {
+			iKey2--
+		}
+		stack.pop()
+	}
+
+	// the dummy item consumed due to an off by one in the original
+	// implementation
+	if len(*stack) < 1 {
+		return false, scriptError(ScriptErrInvalidStackOperation)
+	}
+	if e.flags&VerifyNullDummy != 0 && len(stack.top(-1)) != 0 {
+		return false, scriptError(ScriptErrSigNullDummy)
+	}
+	stack.pop()
+
+	return ok, nil
+}
+
+// checkLockTime reports whether the transaction locktime satisfies the
+// OP_CHECKLOCKTIMEVERIFY operand lockTime (BIP65).
+func (e *engine) checkLockTime(lockTime int64) bool {
+	txLockTime := int64(e.tx.LockTime)
+
+	// both must be heights or both times
+	if (txLockTime < lockTimeThreshold) != (lockTime < lockTimeThreshold) {
+		return false
+	}
+	if lockTime > txLockTime {
+		return false
+	}
+
+	// a final input disables the transaction locktime
+	return e.tx.Inputs[e.index].SeqNo != 0xffffffff
+}
+
+// checkSequence reports whether the input sequence satisfies the
+// OP_CHECKSEQUENCEVERIFY operand sequence (BIP112).
+func (e *engine) checkSequence(sequence int64) bool {
+	txSequence := int64(e.tx.Inputs[e.index].SeqNo)
+
+	if e.tx.Version < 2 || txSequence&sequenceLockTimeDisabled != 0 {
+		return false
+	}
+
+	mask := int64(sequenceLockTimeTypeFlag | sequenceLockTimeMask)
+	txMasked, masked := txSequence&mask, sequence&mask
+
+	if (txMasked < sequenceLockTimeTypeFlag) != (masked < sequenceLockTimeTypeFlag) {
+		return false
+	}
+	return masked <= txMasked
+}
+
+// isMinimalPush reports whether op pushes its data with the shortest
+// encoding, as required by VerifyMinimalData.
+func isMinimalPush(op Op) bool {
+	switch n := len(op.Data); {
+	case n == 0:
+		return op.Opcode == OpFalse
+	case n == 1 && op.Data[0] >= 1 && op.Data[0] <= 16:
+		return false
+	case n == 1 && op.Data[0] == 0x81:
+		return false
+	case n <= 75:
+		return int(op.Opcode) == n
+	case n <= 255:
+		return op.Opcode == OpPushData1
+	case n <= 65535:
+		return op.Opcode == OpPushData2
+	}
+	return true
+}
+
+// isOpSuccess reports whether o is one of the OP_SUCCESSx opcodes that make
+// a tapscript succeed unconditionally (BIP342).
+func isOpSuccess(o Opcode) bool {
+	return o == 80 || o == 98 || (o >= 126 && o <= 129) || (o >= 131 && o <= 134) ||
+		(o >= 137 && o <= 138) || (o >= 141 && o <= 142) || (o >= 149 && o <= 153) ||
+		(o >= 187 && o <= 254)
+}
+
+// findAndDelete removes every occurrence of the script sub at an op
+// boundary of script, reporting whether any was found.
+func findAndDelete(script Script, sub []byte) (Script, bool) {
+	if len(sub) == 0 {
+		return script, false
+	}
+
+	out := make(Script, 0, len(script))
+	found := false
+	pc := 0
+	for pc < len(script) {
+		for bytes.HasPrefix(script[pc:], sub) {
+			pc += len(sub)
+			found = true
+		}
+		if pc >= len(script) {
+			break
+		}
+
+		_, n, err := script.opAt(pc)
+		if err != nil {
+			out = append(out, script[pc:]...)
+			break
+		}
+		out = append(out, script[pc:pc+n]...)
+		pc += n
+	}
+
+	if !found {
+		return script, false
+	}
+	return out, true
+}
+
+// pushScript returns the script pushing data with the shortest push
+// opcode, as Bitcoin Core serializes data pushes.
+func pushScript(data []byte) []byte {
+	n := len(data)
+	var out []byte
+	switch {
+	case n < int(OpPushData1):
+		out = []byte{byte(n)}
+	case n <= 0xff:
+		out = []byte{byte(OpPushData1), byte(n)}
+	case n <= 0xffff:
+		out = []byte{byte(OpPushData2), byte(n), byte(n >> 8)}
+	default:
+		out = []byte{byte(OpPushData4), byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)}
+	}
+	return append(out, data...)
+}
+
+// parseScriptNum decodes a little endian sign and magnitude number operand
+// of at most maxSize bytes.
+func parseScriptNum(v []byte, minimal bool, maxSize int) (int64, error) {
+	if len(v) > maxSize {
+		return 0, scriptError(ScriptErrUnknown)
+	}
+
+	if minimal && len(v) > 0 && v[len(v)-1]&0x7f == 0 {
+		// the last byte may only be zero to make room for the sign bit
+		if len(v) == 1 || v[len(v)-2]&0x80 == 0 {
+			return 0, scriptError(ScriptErrUnknown)
+		}
+	}
+
+	return scriptNum(v), nil
+}
+
+// scriptNumBytes encodes n as a minimal script number.
+func scriptNumBytes(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+
+	neg := n < 0
+	abs := uint64(n)
+	if neg {
+		abs = uint64(-n)
+	}
+
+	var out []byte
+	for abs > 0 {
+		out = append(out, byte(abs))
+		abs >>= 8
+	}
+
+	if out[len(out)-1]&0x80 != 0 {
+		if neg {
+			out = append(out, 0x80)
+		} else {
+			out = append(out, 0)
+		}
+	} else if neg {
+		out[len(out)-1] |= 0x80
+	}
+	return out
+}
+
+// castToBool interprets a stack item as a boolean: false if all zero,
+// allowing for negative zero.
+func castToBool(v []byte) bool {
+	for i, b := range v {
+		if b != 0 {
+			return !(i == len(v)-1 && b == 0x80)
+		}
+	}
+	return false
+}
+
+func boolBytes(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{}
+}
+
+func boolNum(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
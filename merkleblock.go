@@ -0,0 +1,297 @@
+package ipldbtc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+)
+
+// maxMerkleBlockTxs bounds the transaction count of a merkleblock message,
+// mirroring Bitcoin Core which allows no more than fit in a block at the
+// minimum transaction weight.
+const maxMerkleBlockTxs = 4000000 / 240
+
+// DecodeMerkleBlock decodes a BIP37 merkleblock message into the Block and
+// the TxTree nodes its partial merkle tree proves, ending with the merkle
+// root unless no transaction matched, along with the CIDs of the matched
+// transactions. The partial tree must hash to the merkle root in the header.
+func DecodeMerkleBlock(b []byte) ([]node.Node, []cid.Cid, error) {
+	r := newReader(bufio.NewReader(bytes.NewReader(b)))
+	blk, err := readBlock(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buf, err := readFixedSlice(r, "total_transactions", 4)
+	if err != nil {
+		return nil, nil, err
+	}
+	nTx := binary.LittleEndian.Uint32(buf)
+	if nTx == 0 || nTx > maxMerkleBlockTxs {
+		return nil, nil, newDecodeError("total_transactions", r.off-4, fmt.Errorf("%w: %d transactions", ErrInvalidMerkleBlock, nTx))
+	}
+
+	nHashes, err := readVarint(r, "hash_count")
+	if err != nil {
+		return nil, nil, err
+	}
+	if nHashes > int(nTx) {
+		return nil, nil, newDecodeError("hash_count", r.off, fmt.Errorf("%w: %d hashes for %d transactions", ErrInvalidMerkleBlock, nHashes, nTx))
+	}
+
+	hashes := make([]cid.Cid, nHashes)
+	for i := range hashes {
+		h, err := readFixedSlice(r, fmt.Sprintf("hashes[%d]", i), 32)
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes[i] = hashToCid(h, cid.BitcoinTx)
+	}
+
+	flags, err := readVarSlice(r, "flags")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := r.br.ReadByte(); err != io.EOF {
+		return nil, nil, newDecodeError("merkleblock", r.off, fmt.Errorf("trailing data"))
+	}
+
+	pt := &partialTree{
+		nTx:    nTx,
+		hashes: hashes,
+		flags:  flags,
+	}
+	root, err := pt.extract(merkleHeight(nTx), 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pt.hashesUsed != len(hashes) || (pt.bitsUsed+7)/8 != len(flags) {
+		return nil, nil, fmt.Errorf("%w: not all hashes and flags were used", ErrInvalidMerkleBlock)
+	}
+
+	if err := checkMerkleRoot(blk, root, false); err != nil {
+		return nil, nil, err
+	}
+
+	out := []node.Node{blk}
+	for _, t := range pt.trees {
+		out = append(out, t)
+	}
+
+	return out, pt.matched, nil
+}
+
+// EncodeMerkleBlock encodes a BIP37 merkleblock message proving the
+// transactions in matched. nodes must contain the Block and all of its txid
+// TxTree nodes, as returned by DecodeBlockMessage.
+func EncodeMerkleBlock(nodes []node.Node, matched []cid.Cid) ([]byte, error) {
+	var blk *Block
+	trees := make(map[cid.Cid]*TxTree)
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Block:
+			blk = n
+		case *TxTree:
+			trees[n.Cid()] = n
+		}
+	}
+
+	if blk == nil || !blk.MerkleRoot.Defined() {
+		return nil, fmt.Errorf("no block header among the nodes")
+	}
+
+	var leaves []cid.Cid
+	if !merkleLeaves(trees, blk.MerkleRoot, merkleDepth(trees, blk.MerkleRoot), &leaves) {
+		return nil, fmt.Errorf("block tree nodes are incomplete")
+	}
+	if len(leaves) > maxMerkleBlockTxs {
+		return nil, fmt.Errorf("%w: %d transactions", ErrInvalidMerkleBlock, len(leaves))
+	}
+
+	match := make(map[cid.Cid]bool)
+	for _, c := range matched {
+		match[c] = true
+	}
+
+	pt := &partialTree{nTx: uint32(len(leaves))}
+	pt.layers = [][]cid.Cid{leaves}
+	pt.match = make([]bool, len(leaves))
+	for i, c := range leaves {
+		pt.match[i] = match[c]
+	}
+	for layer := leaves; len(layer) > 1; {
+		_, _, next := merkleLayer(layer)
+		pt.layers = append(pt.layers, next)
+		layer = next
+	}
+
+	pt.build(merkleHeight(pt.nTx), 0)
+
+	buf := bytes.NewBuffer(blk.RawData())
+
+	i := make([]byte, 4)
+	binary.LittleEndian.PutUint32(i, pt.nTx)
+	buf.Write(i)
+
+	if _, err := writeVarInt(buf, uint64(len(pt.hashes))); err != nil {
+		return nil, err
+	}
+	for _, h := range pt.hashes {
+		buf.Write(cidToHash(h))
+	}
+
+	if _, err := writeVarInt(buf, uint64(len(pt.flags))); err != nil {
+		return nil, err
+	}
+	buf.Write(pt.flags)
+
+	return buf.Bytes(), nil
+}
+
+// merkleDepth returns the depth of the leftmost leaf of the merkle tree
+// rooted at root.
+func merkleDepth(trees map[cid.Cid]*TxTree, root cid.Cid) int {
+	depth := 0
+	for t, ok := trees[root]; ok; t, ok = trees[t.Left.Cid] {
+		depth++
+	}
+	return depth
+}
+
+// merkleLeaves appends the leaves of the merkle tree rooted at root to out,
+// without the duplicates added to odd sized layers. It returns false if not
+// all leaves are at the given depth, as happens if tree nodes are missing.
+func merkleLeaves(trees map[cid.Cid]*TxTree, root cid.Cid, depth int, out *[]cid.Cid) bool {
+	t, ok := trees[root]
+	if !ok || depth == 0 {
+		*out = append(*out, root)
+		return !ok && depth == 0
+	}
+
+	if !merkleLeaves(trees, t.Left.Cid, depth-1, out) {
+		return false
+	}
+	if t.Right.Cid.Equals(t.Left.Cid) {
+		return true
+	}
+	return merkleLeaves(trees, t.Right.Cid, depth-1, out)
+}
+
+// merkleHeight returns the height of the merkle tree over nTx transactions.
+func merkleHeight(nTx uint32) int {
+	height := 0
+	for treeWidth(nTx, height) > 1 {
+		height++
+	}
+	return height
+}
+
+// treeWidth returns the number of nodes at the given height of the merkle
+// tree over nTx transactions.
+func treeWidth(nTx uint32, height int) uint32 {
+	return uint32((uint64(nTx) + (1 << uint(height)) - 1) >> uint(height))
+}
+
+// partialTree holds the state of building or extracting a BIP37 partial
+// merkle tree, traversed depth first as in Bitcoin Core.
+type partialTree struct {
+	nTx    uint32
+	hashes []cid.Cid
+	flags  []byte
+
+	// used when building
+	layers [][]cid.Cid
+	match  []bool
+
+	// used when extracting
+	hashesUsed int
+	bitsUsed   int
+	trees      []*TxTree
+	matched    []cid.Cid
+}
+
+func (pt *partialTree) pushBit(bit bool) {
+	if pt.bitsUsed%8 == 0 {
+		pt.flags = append(pt.flags, 0)
+	}
+	if bit {
+		pt.flags[pt.bitsUsed/8] |= 1 << uint(pt.bitsUsed%8)
+	}
+	pt.bitsUsed++
+}
+
+func (pt *partialTree) build(height int, pos uint32) {
+	// a node is the parent of a match if any leaf below it matched
+	parentOfMatch := false
+	for p := uint64(pos) << uint(height); p < uint64(pos+1)<<uint(height) && p < uint64(pt.nTx); p++ {
+		if pt.match[p] {
+			parentOfMatch = true
+			break
+		}
+	}
+
+	pt.pushBit(parentOfMatch)
+	if height == 0 || !parentOfMatch {
+		pt.hashes = append(pt.hashes, pt.layers[height][pos])
+		return
+	}
+
+	pt.build(height-1, pos*2)
+	if pos*2+1 < treeWidth(pt.nTx, height-1) {
+		pt.build(height-1, pos*2+1)
+	}
+}
+
+func (pt *partialTree) extract(height int, pos uint32) (cid.Cid, error) {
+	if pt.bitsUsed >= len(pt.flags)*8 {
+		return cid.Undef, fmt.Errorf("%w: ran out of flags", ErrInvalidMerkleBlock)
+	}
+	parentOfMatch := pt.flags[pt.bitsUsed/8]&(1<<uint(pt.bitsUsed%8)) != 0
+	pt.bitsUsed++
+
+	if height == 0 || !parentOfMatch {
+		if pt.hashesUsed >= len(pt.hashes) {
+			return cid.Undef, fmt.Errorf("%w: ran out of hashes", ErrInvalidMerkleBlock)
+		}
+		h := pt.hashes[pt.hashesUsed]
+		pt.hashesUsed++
+
+		if height == 0 && parentOfMatch {
+			pt.matched = append(pt.matched, h)
+		}
+		return h, nil
+	}
+
+	left, err := pt.extract(height-1, pos*2)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	right := left
+	if pos*2+1 < treeWidth(pt.nTx, height-1) {
+		right, err = pt.extract(height-1, pos*2+1)
+		if err != nil {
+			return cid.Undef, err
+		}
+
+		// identical siblings only come from duplicated transactions, see
+		// mkMerkleTree
+		if right.Equals(left) {
+			return cid.Undef, ErrMutatedMerkleTree
+		}
+	}
+
+	t := &TxTree{
+		Left:  &node.Link{Cid: left},
+		Right: &node.Link{Cid: right},
+	}
+	pt.trees = append(pt.trees, t)
+	return t.Cid(), nil
+}
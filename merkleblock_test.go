@@ -0,0 +1,103 @@
+package ipldbtc
+
+import (
+	"errors"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestMerkleBlock(t *testing.T) {
+	for _, fixture := range []string{"block.hex", "segwit3.hex"} {
+		nodes, err := DecodeBlockMessage(loadFixture(t, fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var txs []cid.Cid
+		for _, tx := range blockTxs(nodes) {
+			txs = append(txs, tx.Stripped().Cid())
+		}
+		trees := make(map[cid.Cid]bool)
+		for _, n := range nodes {
+			if n, ok := n.(*TxTree); ok {
+				trees[n.Cid()] = true
+			}
+		}
+
+		for _, matched := range [][]cid.Cid{
+			nil,
+			{txs[0]},
+			{txs[len(txs)-1]},
+			{txs[1], txs[7], txs[len(txs)/2], txs[len(txs)-2]},
+			txs,
+		} {
+			data, err := EncodeMerkleBlock(nodes, matched)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, got, err := DecodeMerkleBlock(data)
+			if err != nil {
+				t.Fatalf("%s: %d matches: %s", fixture, len(matched), err)
+			}
+
+			if len(got) != len(matched) {
+				t.Fatalf("%s: expected %d matches, got %d", fixture, len(matched), len(got))
+			}
+			for i := range got {
+				if !got[i].Equals(matched[i]) {
+					t.Fatalf("%s: match %d is %s, expected %s", fixture, i, got[i], matched[i])
+				}
+			}
+
+			if !decoded[0].Cid().Equals(nodes[0].Cid()) {
+				t.Fatalf("%s: header mismatch", fixture)
+			}
+			for _, n := range decoded[1:] {
+				if !trees[n.Cid()] {
+					t.Fatalf("%s: decoded tree node %s is not part of the block", fixture, n.Cid())
+				}
+			}
+			if len(matched) > 0 && !decoded[len(decoded)-1].Cid().Equals(nodes[0].(*Block).MerkleRoot) {
+				t.Fatalf("%s: expected the merkle root last", fixture)
+			}
+		}
+
+		data, err := EncodeMerkleBlock(nodes, txs[3:4])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// flip a byte of the first hash
+		bad := append([]byte{}, data...)
+		bad[85]++
+		if _, _, err := DecodeMerkleBlock(bad); !errors.Is(err, ErrMerkleRootMismatch) {
+			t.Fatalf("%s: expected ErrMerkleRootMismatch, got %v", fixture, err)
+		}
+
+		if _, _, err := DecodeMerkleBlock(append(data, 0)); err == nil {
+			t.Fatalf("%s: expected error for trailing data", fixture)
+		}
+
+		if _, _, err := DecodeMerkleBlock(data[:len(data)-1]); err == nil {
+			t.Fatalf("%s: expected error for truncated message", fixture)
+		}
+	}
+
+	nodes, err := DecodeBlockMessage(loadFixture(t, "block.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncodeMerkleBlock(nodes, []cid.Cid{nodes[1].Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, _, err := DecodeMerkleBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EncodeMerkleBlock(partial, nil); err == nil {
+		t.Fatal("expected error for missing tree nodes")
+	}
+}
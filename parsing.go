@@ -12,38 +12,164 @@ import (
 	mh "github.com/multiformats/go-multihash"
 )
 
-func DecodeBlockMessage(b []byte) ([]node.Node, error) {
-	r := bufio.NewReader(bytes.NewReader(b))
-	blk, err := ReadBlock(r)
+const (
+	// maxVarint is the largest count or length accepted in a compact size
+	// integer, mirroring MAX_SIZE in Bitcoin Core.
+	maxVarint = 0x02000000
+
+	// maxPrealloc bounds how much is allocated up front for a count or length
+	// read from the input, so that malformed data cannot force huge
+	// allocations.
+	maxPrealloc = 1024
+)
+
+// reader wraps a bufio.Reader, keeping track of the offset of the data read
+// so far for error reporting.
+type reader struct {
+	br  *bufio.Reader
+	off int64
+}
+
+func newReader(r *bufio.Reader) *reader {
+	return &reader{br: r}
+}
+
+// DecodeOption configures DecodeBlockMessage and the other decoders taking
+// options. Each option names the decoders it applies to besides
+// DecodeBlockMessage.
+type DecodeOption func(*decodeOptions)
+
+type decodeOptions struct {
+	verifyRoundTrip bool
+	skipMerkleCheck bool
+	network         *Network
+}
+
+// VerifyRoundTrip makes DecodeBlockMessage check that the header, every Tx
+// and every TxTree re-serialize to exactly the bytes they were decoded from,
+// returning a *RoundTripError naming the first node that does not.
+func VerifyRoundTrip() DecodeOption {
+	return func(o *decodeOptions) {
+		o.verifyRoundTrip = true
+	}
+}
+
+// SkipMerkleCheck disables the check that the transactions of a block hash
+// to the merkle root in its header, the check for a mutated merkle tree and
+// the check of the witness commitment of the coinbase against the witness
+// tree. It also applies to NewBlockStreamDecoder.
+func SkipMerkleCheck() DecodeOption {
+	return func(o *decodeOptions) {
+		o.skipMerkleCheck = true
+	}
+}
+
+// AddressNetwork sets the Network of the decoded transactions, whose
+// outputs/N/address paths otherwise resolve to MainNet addresses. It also
+// applies to NewNodeDecoder, RegisterDecoders and NewBlockStreamDecoder.
+func AddressNetwork(net *Network) DecodeOption {
+	return func(o *decodeOptions) {
+		o.network = net
+	}
+}
+
+// DecodeBlockMessage decodes a serialized block into its header, its
+// transactions, the nodes of its witness tree, its WitnessCommitment, the
+// Stripped form of each transaction with witnesses and the nodes of its
+// txid tree, in that order. The last node is therefore the merkle root, which
+// in a block with a single transaction is that transaction, or its Stripped
+// form if it has witnesses.
+//
+// Unless SkipMerkleCheck is given, the transactions must hash to the merkle
+// root in the header, the tree must not be mutated by duplicated
+// transactions (CVE-2012-2459) and the witness tree must match the
+// commitment of a segwit coinbase.
+func DecodeBlockMessage(b []byte, opts ...DecodeOption) ([]node.Node, error) {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := newReader(bufio.NewReader(bytes.NewReader(b)))
+	blk, err := readBlock(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read block header: %s", err)
+		return nil, err
 	}
 
-	if !bytes.Equal(blk.header(), b[:80]) {
-		panic("not the same!")
+	if err := verifyHeader(blk, b[:80]); err != nil {
+		return nil, err
 	}
 
-	nTx, err := readVarint(r)
+	nTx, err := readVarint(r, "tx_count")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read tx_count: %s", err)
+		return nil, err
 	}
 
-	var txs []node.Node
+	var txs []*Tx
 	for i := 0; i < nTx; i++ {
-		tx, err := readTx(r)
+		start := r.off
+		tx, err := readTxFrom(r)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read tx(%d/%d): %s", i, nTx, err)
+			return nil, withTxIndex(err, i)
 		}
+
+		if o.verifyRoundTrip {
+			if err := verifyTx(tx, b[start:r.off], i, start); err != nil {
+				return nil, err
+			}
+		}
+		tx.Network = o.network
 		txs = append(txs, tx)
 	}
 
-	txtrees, err := mkMerkleTree(txs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to mk merkle tree: %s", err)
+	leaves := make([]cid.Cid, len(txs))
+	for i, tx := range txs {
+		leaves[i] = tx.Stripped().Cid()
+	}
+	txtrees, root, mutated := mkMerkleTree(leaves)
+	if !o.skipMerkleCheck {
+		if err := checkMerkleRoot(blk, root, mutated); err != nil {
+			return nil, err
+		}
+	}
+	blk.txSize = setTxTreeSizes(txs, leaves, txtrees, root)
+
+	wtrees, wc, err := mkWitnessTree(txs)
+	if err != nil && !o.skipMerkleCheck {
+		return nil, err
+	}
+
+	// the tree nodes are checked against the hashes of the transactions, in
+	// the order they are returned
+	if o.verifyRoundTrip {
+		if err := verifyTxTrees(wtrees, witnessLeaves(txs), 0); err != nil {
+			return nil, err
+		}
+		if err := verifyTxTrees(txtrees, leaves, len(wtrees)); err != nil {
+			return nil, err
+		}
 	}
 
 	out := []node.Node{blk}
-	out = append(out, txs...)
+	for _, tx := range txs {
+		out = append(out, tx)
+	}
+
+	for _, wtree := range wtrees {
+		out = append(out, wtree)
+	}
+	if wc != nil {
+		out = append(out, wc)
+	}
+
+	// the txid tree links to segwit transactions without their witnesses,
+	// a separate node addressed by txid. These and the txid tree are kept
+	// last so that the final node is the merkle root.
+	for _, tx := range txs {
+		if tx.HasWitness() {
+			out = append(out, tx.Stripped())
+		}
+	}
 
 	for _, txtree := range txtrees {
 		out = append(out, txtree)
@@ -52,78 +178,196 @@ func DecodeBlockMessage(b []byte) ([]node.Node, error) {
 	return out, nil
 }
 
-func mkMerkleTree(txs []node.Node) ([]*TxTree, error) {
-	var out []*TxTree
-	var next []node.Node
-	layer := txs
-	for len(layer) > 1 {
-		if len(layer)%2 != 0 {
-			layer = append(layer, layer[len(layer)-1])
-		}
-		for i := 0; i < len(layer)/2; i++ {
-			var left, right node.Node
-			left = layer[i*2]
-			right = layer[(i*2)+1]
-
-			t := &TxTree{
-				Left:  &node.Link{Cid: left.Cid()},
-				Right: &node.Link{Cid: right.Cid()},
+// verifyHeader checks that blk serializes to raw, the header it was decoded
+// from.
+func verifyHeader(blk *Block, raw []byte) error {
+	if !bytes.Equal(blk.header(), raw) {
+		return &RoundTripError{Node: "header", Cid: blk.Cid()}
+	}
+	return nil
+}
+
+// verifyTx checks that tx, the i-th transaction of the block, serializes to
+// raw, the bytes it was decoded from at offset off.
+func verifyTx(tx *Tx, raw []byte, i int, off int64) error {
+	if !bytes.Equal(tx.RawData(), raw) {
+		return &RoundTripError{Node: "tx", Index: i, Offset: off, Cid: tx.Cid()}
+	}
+	return nil
+}
+
+// verifyTxTrees checks trees, the nodes of a merkle tree as built by
+// mkMerkleTree, against the tree computed afresh from its leaves: each node
+// must serialize to the hashes of the two children computed below it, and
+// decode back to links to them. base is the index of trees[0] among the
+// TxTree nodes returned by DecodeBlockMessage.
+func verifyTxTrees(trees []*TxTree, leaves []cid.Cid, base int) error {
+	var k int
+	for layer := leaves; len(layer) > 1; {
+		next := make([]cid.Cid, 0, (len(layer)+1)/2)
+		for j := 0; j < len(layer); j += 2 {
+			left, right := layer[j], layer[j]
+			if j+1 < len(layer) {
+				right = layer[j+1]
 			}
+			raw := append(append([]byte{}, cidToHash(left)...), cidToHash(right)...)
 
-			out = append(out, t)
-			next = append(next, t)
+			if k == len(trees) {
+				return &RoundTripError{Node: "tx_tree", Index: base + k, Offset: -1}
+			}
+			t := trees[k]
+			dec, err := DecodeTxTree(t.RawData())
+			if err != nil || !bytes.Equal(t.RawData(), raw) ||
+				!t.Left.Cid.Equals(left) || !t.Right.Cid.Equals(right) ||
+				!dec.Left.Cid.Equals(left) || !dec.Right.Cid.Equals(right) {
+				return &RoundTripError{Node: "tx_tree", Index: base + k, Offset: -1, Cid: t.Cid()}
+			}
+
+			h, _ := mh.Sum(raw, mh.DBL_SHA2_256, -1)
+			next = append(next, cid.NewCidV1(cid.BitcoinTx, h))
+			k++
 		}
+		layer = next
+	}
+
+	if k != len(trees) {
+		return &RoundTripError{Node: "tx_tree", Index: base + k, Offset: -1, Cid: trees[k].Cid()}
+	}
+	return nil
+}
+
+// checkMerkleRoot checks the merkle root computed from the transactions of
+// blk against its header.
+func checkMerkleRoot(blk *Block, root cid.Cid, mutated bool) error {
+	if mutated {
+		return ErrMutatedMerkleTree
+	}
+
+	if !root.Equals(blk.MerkleRoot) {
+		return fmt.Errorf("%w: computed %s, header has %s", ErrMerkleRootMismatch, root, blk.MerkleRoot)
+	}
+	return nil
+}
+
+// setTxTreeSizes sets the size of each link of trees, the merkle tree over
+// txs built by mkMerkleTree from their CIDs leaves, to the cumulative size
+// of its target, and returns the cumulative size of the tree at root.
+func setTxTreeSizes(txs []*Tx, leaves []cid.Cid, trees []*TxTree, root cid.Cid) uint64 {
+	sizes := make(map[cid.Cid]uint64, len(txs)+len(trees))
+	for i, tx := range txs {
+		sizes[leaves[i]] = uint64(tx.StrippedSize())
+	}
+
+	for _, t := range trees {
+		t.Left.Size = sizes[t.Left.Cid]
+		t.Right.Size = sizes[t.Right.Cid]
+		sizes[t.Cid()] = t.cumulativeSize()
+	}
+	return sizes[root]
+}
+
+// mkMerkleTree builds the layers of a bitcoin merkle tree over the given
+// leaves, duplicating the last entry of odd sized layers. It returns the
+// inner nodes bottom up and the root, which is the single leaf if there is
+// only one.
+//
+// Duplicating the last entry means a list of leaves with its tail repeated
+// gives the same root as the original (CVE-2012-2459). mutated reports
+// whether any pair of siblings is identical, which only happens for such a
+// list.
+func mkMerkleTree(leaves []cid.Cid) (trees []*TxTree, root cid.Cid, mutated bool) {
+	if len(leaves) == 0 {
+		return nil, cid.Undef, false
+	}
 
+	layer := leaves
+	for len(layer) > 1 {
+		layerTrees, layerMutated, next := merkleLayer(layer)
+		trees = append(trees, layerTrees...)
+		mutated = mutated || layerMutated
 		layer = next
-		next = nil
 	}
 
-	return out, nil
+	return trees, layer[0], mutated
+}
+
+// merkleLayer computes the next layer of a merkle tree, duplicating the last
+// entry of odd sized layers.
+func merkleLayer(layer []cid.Cid) ([]*TxTree, bool, []cid.Cid) {
+	var trees []*TxTree
+	var mutated bool
+	next := make([]cid.Cid, 0, (len(layer)+1)/2)
+	for i := 0; i < len(layer); i += 2 {
+		left := layer[i]
+		right := left
+		if i+1 < len(layer) {
+			right = layer[i+1]
+			if right.Equals(left) {
+				mutated = true
+			}
+		}
+
+		t := &TxTree{
+			Left:  &node.Link{Cid: left},
+			Right: &node.Link{Cid: right},
+		}
+
+		trees = append(trees, t)
+		next = append(next, t.Cid())
+	}
+
+	return trees, mutated, next
 }
 
 func DecodeBlock(b []byte) (*Block, error) {
 	return ReadBlock(bufio.NewReader(bytes.NewReader(b)))
 }
 
+// ReadBlock reads a block header from r. Decoding failures are reported as
+// a *DecodeError with offsets relative to the start of the header.
 func ReadBlock(r *bufio.Reader) (*Block, error) {
+	return readBlock(newReader(r))
+}
+
+func readBlock(r *reader) (*Block, error) {
 	var blk Block
 
-	version, err := readFixedSlice(r, 4)
+	version, err := readFixedSlice(r, "version", 4)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read version: %s", err)
+		return nil, err
 	}
 	blk.Version = binary.LittleEndian.Uint32(version)
 
-	prevBlock, err := readFixedSlice(r, 32)
+	prevBlock, err := readFixedSlice(r, "prev_block", 32)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read prev_block: %s", err)
+		return nil, err
 	}
 
 	blkhash, _ := mh.Encode(prevBlock, mh.DBL_SHA2_256)
 	blk.Parent = cid.NewCidV1(cid.BitcoinBlock, blkhash)
 
-	merkleRoot, err := readFixedSlice(r, 32)
+	merkleRoot, err := readFixedSlice(r, "merkle_root", 32)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read merkle_root: %s", err)
+		return nil, err
 	}
 	txroothash, _ := mh.Encode(merkleRoot, mh.DBL_SHA2_256)
 	blk.MerkleRoot = cid.NewCidV1(cid.BitcoinTx, txroothash)
 
-	timestamp, err := readFixedSlice(r, 4)
+	timestamp, err := readFixedSlice(r, "timestamp", 4)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read timestamp: %s", err)
+		return nil, err
 	}
 	blk.Timestamp = binary.LittleEndian.Uint32(timestamp)
 
-	diff, err := readFixedSlice(r, 4)
+	diff, err := readFixedSlice(r, "difficulty", 4)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read difficulty: %s", err)
+		return nil, err
 	}
 	blk.Difficulty = binary.LittleEndian.Uint32(diff)
 
-	nonce, err := readFixedSlice(r, 4)
+	nonce, err := readFixedSlice(r, "nonce", 4)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read nonce: %s", err)
+		return nil, err
 	}
 	blk.Nonce = binary.LittleEndian.Uint32(nonce)
 
@@ -132,7 +376,7 @@ func ReadBlock(r *bufio.Reader) (*Block, error) {
 
 func DecodeMaybeTx(b []byte) (node.Node, error) {
 	if len(b) == 64 {
-		return DecodeTxTree(b)
+		return decodeTxOrTree(b)
 	}
 	return DecodeTx(b)
 }
@@ -172,27 +416,31 @@ func DecodeTxTree(b []byte) (*TxTree, error) {
 //
 //	version | marker | flag | tx_in_count | tx_in | tx_out_count | tx_out | witness | lock_time
 func readTx(r *bufio.Reader) (*Tx, error) {
-	rawVersion, err := readFixedSlice(r, 4)
+	return readTxFrom(newReader(r))
+}
+
+func readTxFrom(r *reader) (*Tx, error) {
+	rawVersion, err := readFixedSlice(r, "version", 4)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse version: %s", err)
+		return nil, err
 	}
 	// version
 	version := binary.LittleEndian.Uint32(rawVersion)
 
 	isSegwit, err := isSegwitTx(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check segwit: %s", err)
+		return nil, err
 	}
 
 	return readTxDetails(r, version, isSegwit)
 }
 
-func isSegwitTx(r *bufio.Reader) (bool, error) {
+func isSegwitTx(r *reader) (bool, error) {
 	// the next two bytes must be [0x00, 0x01] to indicate the new
 	// segwit format
-	header, err := r.Peek(2)
+	header, err := r.br.Peek(2)
 	if err != nil {
-		return false, err
+		return false, newDecodeError("marker", r.off, err)
 	}
 
 	if header[0] == 0x00 && header[1] == 0x01 {
@@ -202,12 +450,13 @@ func isSegwitTx(r *bufio.Reader) (bool, error) {
 	return false, nil
 }
 
-func readTxDetails(r *bufio.Reader, version uint32, isSegwit bool) (*Tx, error) {
+func readTxDetails(r *reader, version uint32, isSegwit bool) (*Tx, error) {
 	if isSegwit {
 		// header & flag validation already happened before
-		_, err := r.Discard(2)
+		n, err := r.br.Discard(2)
+		r.off += int64(n)
 		if err != nil {
-			return nil, err
+			return nil, newDecodeError("marker", r.off, err)
 		}
 	}
 
@@ -229,6 +478,11 @@ func readTxDetails(r *bufio.Reader, version uint32, isSegwit bool) (*Tx, error)
 		if err != nil {
 			return nil, err
 		}
+
+		tx := &Tx{Witnesses: witnesses}
+		if !tx.HasWitness() {
+			return nil, newDecodeError("witness", r.off, ErrSuperfluousWitness)
+		}
 	}
 	lockTime, err := readTxLockTime(r)
 	if err != nil {
@@ -244,22 +498,22 @@ func readTxDetails(r *bufio.Reader, version uint32, isSegwit bool) (*Tx, error)
 	}, nil
 }
 
-func readTxWitnesses(r *bufio.Reader, ctr int) ([]*Witness, error) {
+func readTxWitnesses(r *reader, ctr int) ([]*Witness, error) {
 	witnesses := make([]*Witness, ctr)
 
 	for i := 0; i < ctr; i++ {
-		witCtr, err := readVarint(r)
+		witCtr, err := readVarint(r, "count")
 		if err != nil {
-			return nil, err
+			return nil, prefixField(err, fmt.Sprintf("witness[%d].", i))
 		}
 
-		items := make([][]byte, witCtr)
+		items := make([][]byte, 0, min(witCtr, maxPrealloc))
 		for j := 0; j < witCtr; j++ {
-			item, err := readVarSlice(r)
+			item, err := readVarSlice(r, "item")
 			if err != nil {
-				return nil, err
+				return nil, prefixField(err, fmt.Sprintf("witness[%d][%d].", i, j))
 			}
-			items[j] = item
+			items = append(items, item)
 		}
 		witnesses[i] = &Witness{
 			Data: items,
@@ -269,47 +523,47 @@ func readTxWitnesses(r *bufio.Reader, ctr int) ([]*Witness, error) {
 	return witnesses, nil
 }
 
-func readTxInputs(r *bufio.Reader) ([]*TxIn, error) {
-	inCtr, err := readVarint(r)
+func readTxInputs(r *reader) ([]*TxIn, error) {
+	inCtr, err := readVarint(r, "in_count")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read in_count: %s", err)
+		return nil, err
 	}
 
-	out := make([]*TxIn, inCtr)
+	out := make([]*TxIn, 0, min(inCtr, maxPrealloc))
 
 	for i := 0; i < inCtr; i++ {
 		txin, err := parseTxIn(r)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse tx_in(%d/%d): %s", i, inCtr, err)
+			return nil, prefixField(err, fmt.Sprintf("tx_in[%d].", i))
 		}
-		out[i] = txin
+		out = append(out, txin)
 	}
 
 	return out, nil
 }
 
-func readTxOutputs(r *bufio.Reader) ([]*TxOut, error) {
-	outCtr, err := readVarint(r)
+func readTxOutputs(r *reader) ([]*TxOut, error) {
+	outCtr, err := readVarint(r, "out_count")
 	if err != nil {
 		return nil, err
 	}
 
-	out := make([]*TxOut, outCtr)
+	out := make([]*TxOut, 0, min(outCtr, maxPrealloc))
 
 	for i := 0; i < outCtr; i++ {
 		txout, err := parseTxOut(r)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read tx_out(%d/%d): %s", i, outCtr, err)
+			return nil, prefixField(err, fmt.Sprintf("tx_out[%d].", i))
 		}
 
-		out[i] = txout
+		out = append(out, txout)
 	}
 
 	return out, nil
 }
 
-func readTxLockTime(r *bufio.Reader) (uint32, error) {
-	lockTime, err := readFixedSlice(r, 4)
+func readTxLockTime(r *reader) (uint32, error) {
+	lockTime, err := readFixedSlice(r, "lock_time", 4)
 	if err != nil {
 		return 0, err
 	}
@@ -317,25 +571,25 @@ func readTxLockTime(r *bufio.Reader) (uint32, error) {
 	return binary.LittleEndian.Uint32(lockTime), nil
 }
 
-func parseTxIn(r *bufio.Reader) (*TxIn, error) {
-	prevTxHash, err := readFixedSlice(r, 32)
+func parseTxIn(r *reader) (*TxIn, error) {
+	prevTxHash, err := readFixedSlice(r, "prev_tx_hash", 32)
 	if err != nil {
-		return nil, fmt.Errorf("prev_tx_hash: %s", err)
+		return nil, err
 	}
 
-	prevTxIndex, err := readFixedSlice(r, 4)
+	prevTxIndex, err := readFixedSlice(r, "prev_tx_index", 4)
 	if err != nil {
-		return nil, fmt.Errorf("prev_tx_index: %s", err)
+		return nil, err
 	}
 
-	script, err := readVarSlice(r)
+	script, err := readVarSlice(r, "script")
 	if err != nil {
-		return nil, fmt.Errorf("script: %s", err)
+		return nil, err
 	}
 
-	seqNo, err := readFixedSlice(r, 4)
+	seqNo, err := readFixedSlice(r, "seqno", 4)
 	if err != nil {
-		return nil, fmt.Errorf("seqno: %s", err)
+		return nil, err
 	}
 
 	return &TxIn{
@@ -346,13 +600,13 @@ func parseTxIn(r *bufio.Reader) (*TxIn, error) {
 	}, nil
 }
 
-func parseTxOut(r *bufio.Reader) (*TxOut, error) {
-	value, err := readFixedSlice(r, 8)
+func parseTxOut(r *reader) (*TxOut, error) {
+	value, err := readFixedSlice(r, "value", 8)
 	if err != nil {
 		return nil, err
 	}
 
-	script, err := readVarSlice(r)
+	script, err := readVarSlice(r, "script")
 	if err != nil {
 		return nil, err
 	}
@@ -364,46 +618,56 @@ func parseTxOut(r *bufio.Reader) (*TxOut, error) {
 	}, nil
 }
 
-func readVarint(r *bufio.Reader) (int, error) {
-	b, err := r.ReadByte()
+func readVarint(r *reader, field string) (int, error) {
+	off := r.off
+	b, err := r.br.ReadByte()
 	if err != nil {
-		return 0, err
+		return 0, newDecodeError(field, off, err)
 	}
+	r.off++
 
-	var res int
+	// lowest is the smallest value that needs the encoding used, anything
+	// below it should have been encoded in fewer bytes
+	var res, lowest uint64
 	switch b {
 	case 0xfd:
-		buf, err := readFixedSlice(r, 2)
+		buf, err := readFixedSlice(r, field, 2)
 		if err != nil {
 			return 0, err
 		}
-		res = int(binary.LittleEndian.Uint16(buf))
+		res = uint64(binary.LittleEndian.Uint16(buf))
+		lowest = 0xfd
 	case 0xfe:
-		buf, err := readFixedSlice(r, 2)
+		buf, err := readFixedSlice(r, field, 4)
 		if err != nil {
 			return 0, err
 		}
 
-		res = int(binary.LittleEndian.Uint32(buf))
+		res = uint64(binary.LittleEndian.Uint32(buf))
+		lowest = 0x10000
 	case 0xff:
-		buf, err := readFixedSlice(r, 8)
+		buf, err := readFixedSlice(r, field, 8)
 		if err != nil {
 			return 0, err
 		}
 
-		res = int(binary.LittleEndian.Uint64(buf))
+		res = binary.LittleEndian.Uint64(buf)
+		lowest = 0x100000000
 	default:
-		res = int(b)
+		res = uint64(b)
+	}
+
+	if res < lowest {
+		return 0, newDecodeError(field, off, ErrNonCanonicalVarint)
 	}
 
-	// all varints we are reading are actually unsigned,
-	// so if they are suddenly signed this means there was an overflow
-	// on int.
-	if res < 0 {
-		return 0, fmt.Errorf("varint overflow: %d", res)
+	// all varints we are reading are counts or lengths, none of which can
+	// exceed the size of a block
+	if res > maxVarint {
+		return 0, newDecodeError(field, off, fmt.Errorf("%w: %d", ErrOversize, res))
 	}
 
-	return res, nil
+	return int(res), nil
 }
 
 func writeVarInt(w io.Writer, n uint64) (int, error) {
@@ -414,32 +678,46 @@ func writeVarInt(w io.Writer, n uint64) (int, error) {
 		d = make([]byte, 3)
 		binary.LittleEndian.PutUint16(d[1:], uint16(n))
 		d[0] = 0xFD
-	} else if n <= 0xFFFFFFF {
+	} else if n <= 0xFFFFFFFF {
 		d = make([]byte, 5)
 		binary.LittleEndian.PutUint32(d[1:], uint32(n))
 		d[0] = 0xFE
 	} else {
 		d = make([]byte, 9)
 		binary.LittleEndian.PutUint64(d[1:], n)
-		d[0] = 0xFE
+		d[0] = 0xFF
 	}
 	return w.Write(d)
 }
 
-func readVarSlice(r *bufio.Reader) ([]byte, error) {
-	length, err := readVarint(r)
+func readVarSlice(r *reader, field string) ([]byte, error) {
+	length, err := readVarint(r, field)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read length: %s", err)
+		return nil, err
 	}
 
-	return readFixedSlice(r, length)
+	return readFixedSlice(r, field, length)
 }
 
-func readFixedSlice(r *bufio.Reader, length int) ([]byte, error) {
+func readFixedSlice(r *reader, field string, length int) ([]byte, error) {
+	off := r.off
+	if length > maxPrealloc {
+		// grow the buffer as data arrives rather than trusting a length
+		// read from the input
+		var buf bytes.Buffer
+		n, err := io.CopyN(&buf, r.br, int64(length))
+		r.off += n
+		if err != nil {
+			return nil, newDecodeError(field, off, err)
+		}
+		return buf.Bytes(), nil
+	}
+
 	out := make([]byte, length)
-	_, err := io.ReadFull(r, out)
+	n, err := io.ReadFull(r.br, out)
+	r.off += int64(n)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read all bytes(%d): %s", length, err)
+		return nil, newDecodeError(field, off, err)
 	}
 
 	return out, nil
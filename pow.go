@@ -0,0 +1,68 @@
+package ipldbtc
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Target decodes the compact Difficulty (nBits) field of the header into the
+// proof of work target, the largest header hash the block may have. Encodings
+// of negative or overflowing targets, which no valid block uses, are
+// rejected with ErrInvalidTarget.
+func (b *Block) Target() (*big.Int, error) {
+	size := uint(b.Difficulty >> 24)
+	word := int64(b.Difficulty & 0x007fffff)
+
+	target := big.NewInt(word)
+	if size <= 3 {
+		target.Rsh(target, 8*(3-size))
+	} else {
+		target.Lsh(target, 8*(size-3))
+	}
+
+	if word != 0 && b.Difficulty&0x00800000 != 0 {
+		return nil, fmt.Errorf("%w: negative target %08x", ErrInvalidTarget, b.Difficulty)
+	}
+
+	if target.BitLen() > 256 {
+		return nil, fmt.Errorf("%w: target %08x overflows 256 bits", ErrInvalidTarget, b.Difficulty)
+	}
+
+	return target, nil
+}
+
+// Work returns the expected number of hashes needed to find a header
+// meeting the target of this block, 2^256 / (target + 1). Summed over a
+// chain this gives its total chain work. Headers with an invalid or zero
+// target have no work.
+func (b *Block) Work() *big.Int {
+	target, err := b.Target()
+	if err != nil || target.Sign() == 0 {
+		return new(big.Int)
+	}
+
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
+
+// CheckProofOfWork checks that the hash of the header does not exceed the
+// target it encodes. It does not check the target against the minimum
+// difficulty of any network.
+func (b *Block) CheckProofOfWork() error {
+	target, err := b.Target()
+	if err != nil {
+		return err
+	}
+
+	if target.Sign() == 0 {
+		return fmt.Errorf("%w: zero target", ErrInvalidTarget)
+	}
+
+	// BTCSha is little endian, big.Int expects big endian
+	hash := new(big.Int).SetBytes(revString(b.BTCSha()))
+	if hash.Cmp(target) > 0 {
+		return fmt.Errorf("%w: hash %s above target %064x", ErrProofOfWork, b.HexHash(), target)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package ipldbtc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	for _, c := range []struct {
+		bits   uint32
+		target string
+		err    bool
+	}{
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000", false},
+		{0x1b0404cb, "404cb000000000000000000000000000000000000000000000000", false},
+		{0x05009234, "92340000", false},
+		{0x02123456, "1234", false},
+		{0x01003456, "0", false},
+		{0x04923456, "", true},
+		{0xff123456, "", true},
+	} {
+		target, err := (&Block{Difficulty: c.bits}).Target()
+		if c.err {
+			if !errors.Is(err, ErrInvalidTarget) {
+				t.Fatalf("%08x: expected ErrInvalidTarget, got %v", c.bits, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%08x: %s", c.bits, err)
+		}
+
+		if target.Text(16) != c.target {
+			t.Fatalf("%08x: expected target %s, got %x", c.bits, c.target, target)
+		}
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	for _, fixture := range []string{"block.hex", "segwit.hex", "segwit2.hex", "segwit3.hex"} {
+		blk, err := DecodeBlock(loadFixture(t, fixture)[:80])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := blk.CheckProofOfWork(); err != nil {
+			t.Fatalf("%s: %s", fixture, err)
+		}
+
+		blk.Nonce++
+		if err := blk.CheckProofOfWork(); !errors.Is(err, ErrProofOfWork) {
+			t.Fatalf("%s: expected ErrProofOfWork with a changed nonce, got %v", fixture, err)
+		}
+	}
+
+	// the work of the minimum difficulty used by the genesis block
+	work := (&Block{Difficulty: 0x1d00ffff}).Work()
+	if work.Cmp(big.NewInt(0x100010001)) != 0 {
+		t.Fatalf("expected work 0x100010001, got %x", work)
+	}
+
+	if (&Block{Difficulty: 0x04923456}).Work().Sign() != 0 {
+		t.Fatal("expected no work for an invalid target")
+	}
+}
@@ -0,0 +1,479 @@
+package ipldbtc
+
+import (
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+	ipld "github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/multicodec"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// schemaDSL describes the data model view of the bitcoin types. Field names
+// match the paths understood by the Resolve methods of the go-ipld-format
+// nodes.
+const schemaDSL = `
+type Block struct {
+	version Int
+	parent &Block
+	tx Link
+	timestamp Int
+	difficulty Int
+	nonce Int
+}
+
+type Tx struct {
+	version Int
+	inputs [TxIn]
+	outputs [TxOut]
+	lockTime Int
+	witnesses optional [Witness]
+	witnessCommitment optional &WitnessCommitment
+}
+
+type TxIn struct {
+	prevTx &Tx
+	prevTxIndex Int
+	script Bytes
+	seqNo Int
+}
+
+type TxOut struct {
+	value Int
+	script Bytes
+}
+
+type Witness [Bytes]
+
+type TxTree [Link]
+
+type WitnessCommitment struct {
+	witnessMerkleRoot Link
+	nonce Bytes
+}
+`
+
+type primeBlock struct {
+	Version    uint32
+	Parent     cid.Cid
+	Tx         cid.Cid
+	Timestamp  uint32
+	Difficulty uint32
+	Nonce      uint32
+}
+
+type primeTx struct {
+	Version   uint32
+	Inputs    []primeTxIn
+	Outputs   []primeTxOut
+	LockTime  uint32
+	Witnesses []primeWitness
+	// WitnessCommitment is derived from the coinbase outputs and is ignored
+	// when encoding.
+	WitnessCommitment *cid.Cid
+}
+
+type primeTxIn struct {
+	PrevTx      cid.Cid
+	PrevTxIndex uint32
+	Script      []byte
+	SeqNo       uint32
+}
+
+type primeTxOut struct {
+	Value  uint64
+	Script []byte
+}
+
+type primeWitness [][]byte
+
+type primeTxTree []cid.Cid
+
+type primeWitnessCommitment struct {
+	WitnessMerkleRoot cid.Cid
+	Nonce             []byte
+}
+
+var (
+	blockType  schema.Type
+	txType     schema.Type
+	txTreeType schema.Type
+	wcType     schema.Type
+)
+
+// Prototype holds the schema-typed node prototypes for the bitcoin types.
+var Prototype struct {
+	Block  schema.TypedPrototype
+	Tx     schema.TypedPrototype
+	TxTree schema.TypedPrototype
+
+	WitnessCommitment schema.TypedPrototype
+}
+
+// BlockLinkPrototype, TxLinkPrototype and WitnessCommitmentLinkPrototype
+// build links for bitcoin data stored through a linking.LinkSystem.
+var (
+	BlockLinkPrototype = cidlink.LinkPrototype{Prefix: cid.Prefix{
+		Version:  1,
+		Codec:    cid.BitcoinBlock,
+		MhType:   mh.DBL_SHA2_256,
+		MhLength: -1,
+	}}
+	TxLinkPrototype = cidlink.LinkPrototype{Prefix: cid.Prefix{
+		Version:  1,
+		Codec:    cid.BitcoinTx,
+		MhType:   mh.DBL_SHA2_256,
+		MhLength: -1,
+	}}
+	WitnessCommitmentLinkPrototype = cidlink.LinkPrototype{Prefix: cid.Prefix{
+		Version:  1,
+		Codec:    BitcoinWitnessCommitment,
+		MhType:   mh.DBL_SHA2_256,
+		MhLength: -1,
+	}}
+)
+
+func init() {
+	ts, err := ipld.LoadSchemaBytes([]byte(schemaDSL))
+	if err != nil {
+		panic(fmt.Sprintf("failed to load bitcoin schema: %s", err))
+	}
+
+	blockType = ts.TypeByName("Block")
+	txType = ts.TypeByName("Tx")
+	txTreeType = ts.TypeByName("TxTree")
+	wcType = ts.TypeByName("WitnessCommitment")
+
+	Prototype.Block = bindnode.Prototype((*primeBlock)(nil), blockType)
+	Prototype.Tx = bindnode.Prototype((*primeTx)(nil), txType)
+	Prototype.TxTree = bindnode.Prototype((*primeTxTree)(nil), txTreeType)
+	Prototype.WitnessCommitment = bindnode.Prototype((*primeWitnessCommitment)(nil), wcType)
+
+	multicodec.RegisterEncoder(cid.BitcoinBlock, EncodeBitcoinBlock)
+	multicodec.RegisterDecoder(cid.BitcoinBlock, DecodeBitcoinBlock)
+	multicodec.RegisterEncoder(cid.BitcoinTx, EncodeBitcoinTx)
+	multicodec.RegisterDecoder(cid.BitcoinTx, DecodeBitcoinTx)
+	multicodec.RegisterEncoder(BitcoinWitnessCommitment, EncodeBitcoinWitnessCommitment)
+	multicodec.RegisterDecoder(BitcoinWitnessCommitment, DecodeBitcoinWitnessCommitment)
+}
+
+// PrototypeChooser picks the node prototype to load the target of a bitcoin
+// link with. bitcoin-tx links can point at either a transaction or a merkle
+// tree node, so their targets are loaded untyped.
+func PrototypeChooser(lnk datamodel.Link, _ linking.LinkContext) (datamodel.NodePrototype, error) {
+	if cl, ok := lnk.(cidlink.Link); ok {
+		switch cl.Cid.Type() {
+		case cid.BitcoinBlock:
+			return Prototype.Block, nil
+		case BitcoinWitnessCommitment:
+			return Prototype.WitnessCommitment, nil
+		}
+	}
+	return basicnode.Prototype.Any, nil
+}
+
+// PrimeNode returns a schema-typed go-ipld-prime view of the block header.
+func (b *Block) PrimeNode() schema.TypedNode {
+	return bindnode.Wrap(&primeBlock{
+		Version:    b.Version,
+		Parent:     b.Parent,
+		Tx:         b.MerkleRoot,
+		Timestamp:  b.Timestamp,
+		Difficulty: b.Difficulty,
+		Nonce:      b.Nonce,
+	}, blockType)
+}
+
+// PrimeNode returns a schema-typed go-ipld-prime view of the transaction.
+func (t *Tx) PrimeNode() schema.TypedNode {
+	pt := &primeTx{
+		Version:  t.Version,
+		LockTime: t.LockTime,
+		Inputs:   make([]primeTxIn, len(t.Inputs)),
+		Outputs:  make([]primeTxOut, len(t.Outputs)),
+	}
+
+	for i, inp := range t.Inputs {
+		pt.Inputs[i] = primeTxIn{
+			PrevTx:      inp.PrevTx,
+			PrevTxIndex: inp.PrevTxIndex,
+			Script:      inp.Script,
+			SeqNo:       inp.SeqNo,
+		}
+	}
+
+	for i, out := range t.Outputs {
+		pt.Outputs[i] = primeTxOut{
+			Value:  out.Value,
+			Script: out.Script,
+		}
+	}
+
+	if t.Witnesses != nil {
+		pt.Witnesses = make([]primeWitness, len(t.Witnesses))
+		for i, wit := range t.Witnesses {
+			pt.Witnesses[i] = wit.Data
+		}
+	}
+
+	if c, ok := t.WitnessCommitment(); ok {
+		pt.WitnessCommitment = &c
+	}
+
+	return bindnode.Wrap(pt, txType)
+}
+
+// PrimeNode returns a schema-typed go-ipld-prime view of the tree node.
+func (t *TxTree) PrimeNode() schema.TypedNode {
+	return bindnode.Wrap(&primeTxTree{t.Left.Cid, t.Right.Cid}, txTreeType)
+}
+
+// PrimeNode returns a schema-typed go-ipld-prime view of the witness
+// commitment.
+func (wc *WitnessCommitment) PrimeNode() schema.TypedNode {
+	return bindnode.Wrap(&primeWitnessCommitment{
+		WitnessMerkleRoot: wc.WitnessMerkleRoot.Cid,
+		Nonce:             wc.Nonce,
+	}, wcType)
+}
+
+// FromPrimeNode converts a go-ipld-prime node holding a bitcoin block
+// header, transaction, merkle tree node or witness commitment back into a
+// go-ipld-format node.
+func FromPrimeNode(n datamodel.Node) (node.Node, error) {
+	switch n.Kind() {
+	case datamodel.Kind_List:
+		return txTreeFromPrime(n)
+	case datamodel.Kind_Map:
+		if _, err := n.LookupByString("inputs"); err == nil {
+			return txFromPrime(n)
+		}
+		if _, err := n.LookupByString("witnessMerkleRoot"); err == nil {
+			return witnessCommitmentFromPrime(n)
+		}
+		return blockFromPrime(n)
+	default:
+		return nil, fmt.Errorf("unexpected kind for bitcoin data: %s", n.Kind())
+	}
+}
+
+// DecodeBitcoinBlock is a codec.Decoder for the bitcoin-block multicodec.
+func DecodeBitcoinBlock(na datamodel.NodeAssembler, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if len(b) != 80 {
+		return fmt.Errorf("invalid block header length: %d", len(b))
+	}
+
+	blk, err := DecodeBlock(b)
+	if err != nil {
+		return err
+	}
+
+	return na.AssignNode(blk.PrimeNode().Representation())
+}
+
+// EncodeBitcoinBlock is a codec.Encoder for the bitcoin-block multicodec.
+func EncodeBitcoinBlock(n datamodel.Node, w io.Writer) error {
+	blk, err := blockFromPrime(n)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(blk.RawData())
+	return err
+}
+
+// DecodeBitcoinTx is a codec.Decoder for the bitcoin-tx multicodec. Like
+// DecodeNode, it yields a merkle tree node for 64 bytes of data that is not a
+// well formed transaction.
+func DecodeBitcoinTx(na datamodel.NodeAssembler, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	nd, err := decodeTxOrTree(b)
+	if err != nil {
+		return err
+	}
+
+	switch nd := nd.(type) {
+	case *Tx:
+		return na.AssignNode(nd.PrimeNode().Representation())
+	case *TxTree:
+		return na.AssignNode(nd.PrimeNode().Representation())
+	default:
+		return fmt.Errorf("unexpected node type %T", nd)
+	}
+}
+
+// EncodeBitcoinTx is a codec.Encoder for the bitcoin-tx multicodec. Lists
+// are encoded as merkle tree nodes and maps as transactions, witnesses
+// included, so a LinkSystem stores a segwit transaction under its wtxid and
+// its Stripped form, without witnesses, under its txid.
+func EncodeBitcoinTx(n datamodel.Node, w io.Writer) error {
+	var nd node.Node
+	var err error
+	switch n.Kind() {
+	case datamodel.Kind_List:
+		nd, err = txTreeFromPrime(n)
+	case datamodel.Kind_Map:
+		nd, err = txFromPrime(n)
+	default:
+		err = fmt.Errorf("unexpected kind for bitcoin-tx: %s", n.Kind())
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(nd.RawData())
+	return err
+}
+
+// DecodeBitcoinWitnessCommitment is a codec.Decoder for the
+// bitcoin-witness-commitment multicodec.
+func DecodeBitcoinWitnessCommitment(na datamodel.NodeAssembler, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	wc, err := DecodeWitnessCommitment(b)
+	if err != nil {
+		return err
+	}
+
+	return na.AssignNode(wc.PrimeNode().Representation())
+}
+
+// EncodeBitcoinWitnessCommitment is a codec.Encoder for the
+// bitcoin-witness-commitment multicodec.
+func EncodeBitcoinWitnessCommitment(n datamodel.Node, w io.Writer) error {
+	wc, err := witnessCommitmentFromPrime(n)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(wc.RawData())
+	return err
+}
+
+// unwrapPrime returns the Go value behind n, rebuilding n with proto first if
+// it is not already a node of that type.
+func unwrapPrime(n datamodel.Node, proto schema.TypedPrototype) (interface{}, error) {
+	if tn, ok := n.(schema.TypedNode); ok && tn.Type() == proto.Type() {
+		if v := bindnode.Unwrap(n); v != nil {
+			return v, nil
+		}
+	}
+
+	nb := proto.Representation().NewBuilder()
+	if err := datamodel.Copy(n, nb); err != nil {
+		return nil, err
+	}
+
+	return bindnode.Unwrap(nb.Build()), nil
+}
+
+func blockFromPrime(n datamodel.Node) (*Block, error) {
+	v, err := unwrapPrime(n, Prototype.Block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block: %s", err)
+	}
+
+	pb := v.(*primeBlock)
+	return &Block{
+		Version:    pb.Version,
+		Parent:     pb.Parent,
+		MerkleRoot: pb.Tx,
+		Timestamp:  pb.Timestamp,
+		Difficulty: pb.Difficulty,
+		Nonce:      pb.Nonce,
+	}, nil
+}
+
+func txFromPrime(n datamodel.Node) (*Tx, error) {
+	v, err := unwrapPrime(n, Prototype.Tx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %s", err)
+	}
+
+	pt := v.(*primeTx)
+	tx := &Tx{
+		Version:  pt.Version,
+		LockTime: pt.LockTime,
+		Inputs:   make([]*TxIn, len(pt.Inputs)),
+		Outputs:  make([]*TxOut, len(pt.Outputs)),
+	}
+
+	for i, inp := range pt.Inputs {
+		tx.Inputs[i] = &TxIn{
+			PrevTx:      inp.PrevTx,
+			PrevTxIndex: inp.PrevTxIndex,
+			Script:      inp.Script,
+			SeqNo:       inp.SeqNo,
+		}
+	}
+
+	for i, out := range pt.Outputs {
+		tx.Outputs[i] = &TxOut{
+			Value:  out.Value,
+			Script: out.Script,
+		}
+	}
+
+	if pt.Witnesses != nil {
+		tx.Witnesses = make([]*Witness, len(pt.Witnesses))
+		for i, wit := range pt.Witnesses {
+			tx.Witnesses[i] = &Witness{Data: wit}
+		}
+	}
+
+	return tx, nil
+}
+
+func txTreeFromPrime(n datamodel.Node) (*TxTree, error) {
+	v, err := unwrapPrime(n, Prototype.TxTree)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tx tree: %s", err)
+	}
+
+	pt := *v.(*primeTxTree)
+	if len(pt) != 2 {
+		return nil, fmt.Errorf("tx tree must have exactly two links, got %d", len(pt))
+	}
+
+	return &TxTree{
+		Left:  &node.Link{Cid: pt[0]},
+		Right: &node.Link{Cid: pt[1]},
+	}, nil
+}
+
+func witnessCommitmentFromPrime(n datamodel.Node) (*WitnessCommitment, error) {
+	v, err := unwrapPrime(n, Prototype.WitnessCommitment)
+	if err != nil {
+		return nil, fmt.Errorf("invalid witness commitment: %s", err)
+	}
+
+	pwc := v.(*primeWitnessCommitment)
+	if len(pwc.Nonce) != 32 {
+		return nil, fmt.Errorf("witness reserved value must be 32 bytes, got %d", len(pwc.Nonce))
+	}
+
+	return &WitnessCommitment{
+		WitnessMerkleRoot: &node.Link{Cid: pwc.WitnessMerkleRoot},
+		Nonce:             pwc.Nonce,
+	}, nil
+}
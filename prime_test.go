@@ -0,0 +1,143 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	"github.com/ipld/go-ipld-prime/traversal"
+)
+
+func TestPrimeLinkSystem(t *testing.T) {
+	nodes, err := DecodeBlockMessage(loadFixture(t, "block.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	ctx := context.Background()
+	for i, n := range nodes {
+		var lnk datamodel.Link
+		switch n := n.(type) {
+		case *Block:
+			lnk, err = lsys.Store(linking.LinkContext{Ctx: ctx}, BlockLinkPrototype, n.PrimeNode())
+		case *Tx:
+			lnk, err = lsys.Store(linking.LinkContext{Ctx: ctx}, TxLinkPrototype, n.PrimeNode())
+		case *TxTree:
+			lnk, err = lsys.Store(linking.LinkContext{Ctx: ctx}, TxLinkPrototype, n.PrimeNode())
+		}
+		if err != nil {
+			t.Fatalf("node %d: %s", i, err)
+		}
+
+		if !lnk.(cidlink.Link).Cid.Equals(n.Cid()) {
+			t.Fatalf("node %d: stored under %s, expected %s", i, lnk, n.Cid())
+		}
+	}
+
+	blk := nodes[0].(*Block)
+	root, err := lsys.Load(linking.LinkContext{Ctx: ctx}, cidlink.Link{Cid: blk.Cid()}, Prototype.Block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	back, err := FromPrimeNode(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(back.RawData(), blk.RawData()) {
+		t.Fatal("block did not round trip through the data model")
+	}
+
+	// walk from the block header down the left edge of the merkle tree to
+	// the coinbase transaction
+	ntx := len(blockTxs(nodes))
+
+	path := "tx"
+	for width := ntx; width > 1; width = (width + 1) / 2 {
+		path += "/0"
+	}
+	path += "/outputs/0/value"
+
+	coinbase := nodes[1].(*Tx)
+	prog := traversal.Progress{Cfg: &traversal.Config{
+		Ctx:                            ctx,
+		LinkSystem:                     lsys,
+		LinkTargetNodePrototypeChooser: PrototypeChooser,
+	}}
+
+	val, err := prog.Get(root, datamodel.ParsePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := val.AsInt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uint64(v) != coinbase.Outputs[0].Value {
+		t.Fatalf("expected coinbase value %d, got %d", coinbase.Outputs[0].Value, v)
+	}
+}
+
+func TestPrimeCodecSegwit(t *testing.T) {
+	nodes, err := DecodeBlockMessage(loadFixture(t, "segwit.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memstore.Store{}
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.SetReadStorage(store)
+	lsys.SetWriteStorage(store)
+
+	ctx := context.Background()
+	var segwit int
+	for i, n := range nodes[1:] {
+		tx, ok := n.(*Tx)
+		if !ok || !tx.HasWitness() {
+			continue
+		}
+		segwit++
+
+		// the transaction is stored under its wtxid and its stripped form
+		// under its txid
+		for _, nd := range []*Tx{tx, tx.Stripped()} {
+			lnk, err := lsys.Store(linking.LinkContext{Ctx: ctx}, TxLinkPrototype, nd.PrimeNode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !lnk.(cidlink.Link).Cid.Equals(nd.Cid()) {
+				t.Fatalf("tx %d: %T stored under %s, expected %s", i, nd, lnk, nd.Cid())
+			}
+
+			loaded, err := lsys.Load(linking.LinkContext{Ctx: ctx}, cidlink.Link{Cid: nd.Cid()}, Prototype.Tx)
+			if err != nil {
+				t.Fatalf("tx %d: %s", i, err)
+			}
+
+			back, err := FromPrimeNode(loaded)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(back.RawData(), nd.RawData()) || !back.Cid().Equals(nd.Cid()) {
+				t.Fatalf("tx %d: %s did not round trip through the codec", i, nd.Cid())
+			}
+		}
+	}
+
+	if segwit == 0 {
+		t.Fatal("no segwit transactions in fixture")
+	}
+}
@@ -0,0 +1,209 @@
+package ipldbtc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// maxProofDepth is the largest number of siblings in an inclusion proof, as
+// a block cannot hold more than 2^32 transactions.
+const maxProofDepth = 32
+
+// InclusionProof proves that a transaction is part of a block by giving the
+// sibling of each node on the path from the transaction to the merkle root.
+//
+// The number of transactions in the block fixes the depth of the tree, so
+// that an inner TxTree node, whose 64 bytes could be taken for a
+// transaction, cannot be passed off as one with a shorter path. The merkle
+// root does not commit to that number, so a verifier should check TxCount
+// against the count it knows for the block.
+type InclusionProof struct {
+	// Tx is the txid based CID of the transaction.
+	Tx cid.Cid
+
+	// Index is the position of the transaction in the block. Bit i is set
+	// if the node at height i on the path is a right child.
+	Index uint32
+
+	// TxCount is the number of transactions in the block.
+	TxCount uint32
+
+	// Siblings are the hashes paired with the path, from the leaves up.
+	Siblings []cid.Cid
+}
+
+// BuildInclusionProof builds a proof that the transaction tx is included in
+// the block described by nodes, which must contain the Block and its txid
+// TxTree nodes as returned by DecodeBlockMessage.
+func BuildInclusionProof(nodes []node.Node, tx cid.Cid) (*InclusionProof, error) {
+	var root cid.Cid
+	trees := make(map[cid.Cid]*TxTree)
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Block:
+			root = n.MerkleRoot
+		case *TxTree:
+			trees[n.Cid()] = n
+		}
+	}
+
+	if !root.Defined() {
+		return nil, fmt.Errorf("no block header among the nodes")
+	}
+
+	var leaves []cid.Cid
+	if !merkleLeaves(trees, root, merkleDepth(trees, root), &leaves) {
+		return nil, fmt.Errorf("block tree nodes are incomplete")
+	}
+
+	proof := &InclusionProof{Tx: tx, TxCount: uint32(len(leaves))}
+	if !findInclusionPath(trees, root, tx, 0, proof) {
+		return nil, fmt.Errorf("transaction %s not found in block", tx)
+	}
+
+	return proof, nil
+}
+
+// findInclusionPath searches the subtree at c, at the given depth below the
+// root, for tx, filling in the proof on the way back up.
+func findInclusionPath(trees map[cid.Cid]*TxTree, c, tx cid.Cid, depth int, proof *InclusionProof) bool {
+	if c.Equals(tx) {
+		return true
+	}
+
+	t, ok := trees[c]
+	if !ok || depth >= maxProofDepth {
+		return false
+	}
+
+	if findInclusionPath(trees, t.Left.Cid, tx, depth+1, proof) {
+		proof.Siblings = append(proof.Siblings, t.Right.Cid)
+		return true
+	}
+
+	// a duplicated last node has nothing new on its right
+	if !t.Right.Cid.Equals(t.Left.Cid) && findInclusionPath(trees, t.Right.Cid, tx, depth+1, proof) {
+		proof.Index |= 1 << uint(len(proof.Siblings))
+		proof.Siblings = append(proof.Siblings, t.Left.Cid)
+		return true
+	}
+
+	return false
+}
+
+// VerifyInclusionProof checks that proof leads from its transaction to the
+// merkle root root, as found in the Block header. The path must be as long
+// as the tree over TxCount transactions is deep, and Index must be one of
+// them. Where the path passes a duplicated last node the corresponding Index
+// bit is not checked, as both orders hash the same.
+func VerifyInclusionProof(proof *InclusionProof, root cid.Cid) error {
+	if proof.Index >= proof.TxCount {
+		return fmt.Errorf("%w: index %d out of range for %d transactions", ErrInvalidProof, proof.Index, proof.TxCount)
+	}
+
+	if height := merkleHeight(proof.TxCount); len(proof.Siblings) != height {
+		return fmt.Errorf("%w: %d siblings for a tree of depth %d", ErrInvalidProof, len(proof.Siblings), height)
+	}
+
+	h := cidToHash(proof.Tx)
+	buf := make([]byte, 64)
+	for i, sib := range proof.Siblings {
+		if proof.Index&(1<<uint(i)) != 0 {
+			copy(buf[:32], cidToHash(sib))
+			copy(buf[32:], h)
+		} else {
+			copy(buf[:32], h)
+			copy(buf[32:], cidToHash(sib))
+		}
+
+		sum, err := mh.Sum(buf, mh.DBL_SHA2_256, -1)
+		if err != nil {
+			return err
+		}
+		h = sum[2:]
+	}
+
+	if !bytes.Equal(h, cidToHash(root)) {
+		return fmt.Errorf("%w: proof does not lead to merkle root %s", ErrInvalidProof, root)
+	}
+
+	return nil
+}
+
+// MarshalBinary serializes the proof as the 32 byte txid, the little endian
+// 4 byte index and transaction count and a compact size count followed by
+// the 32 byte sibling hashes, all in bitcoin byte order.
+func (p *InclusionProof) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Write(cidToHash(p.Tx))
+
+	i := make([]byte, 4)
+	binary.LittleEndian.PutUint32(i, p.Index)
+	buf.Write(i)
+	binary.LittleEndian.PutUint32(i, p.TxCount)
+	buf.Write(i)
+
+	if _, err := writeVarInt(buf, uint64(len(p.Siblings))); err != nil {
+		return nil, err
+	}
+
+	for _, sib := range p.Siblings {
+		buf.Write(cidToHash(sib))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a proof serialized by MarshalBinary.
+func (p *InclusionProof) UnmarshalBinary(data []byte) error {
+	r := newReader(bufio.NewReader(bytes.NewReader(data)))
+
+	txid, err := readFixedSlice(r, "tx", 32)
+	if err != nil {
+		return err
+	}
+
+	index, err := readFixedSlice(r, "index", 4)
+	if err != nil {
+		return err
+	}
+
+	txCount, err := readFixedSlice(r, "tx_count", 4)
+	if err != nil {
+		return err
+	}
+
+	n, err := readVarint(r, "sibling_count")
+	if err != nil {
+		return err
+	}
+	if n > maxProofDepth {
+		return newDecodeError("sibling_count", r.off, fmt.Errorf("%w: %d siblings", ErrOversize, n))
+	}
+
+	siblings := make([]cid.Cid, n)
+	for i := range siblings {
+		h, err := readFixedSlice(r, fmt.Sprintf("siblings[%d]", i), 32)
+		if err != nil {
+			return err
+		}
+		siblings[i] = hashToCid(h, cid.BitcoinTx)
+	}
+
+	if _, err := r.br.ReadByte(); err != io.EOF {
+		return newDecodeError("proof", r.off, fmt.Errorf("trailing data"))
+	}
+
+	p.Tx = hashToCid(txid, cid.BitcoinTx)
+	p.Index = binary.LittleEndian.Uint32(index)
+	p.TxCount = binary.LittleEndian.Uint32(txCount)
+	p.Siblings = siblings
+	return nil
+}
@@ -0,0 +1,124 @@
+package ipldbtc
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+)
+
+func TestInclusionProof(t *testing.T) {
+	for _, fixture := range []string{"block.hex", "segwit.hex", "segwit2.hex", "segwit3.hex"} {
+		nodes, err := DecodeBlockMessage(loadFixture(t, fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		root := nodes[0].(*Block).MerkleRoot
+		var txs []cid.Cid
+		for _, tx := range blockTxs(nodes) {
+			txs = append(txs, tx.Stripped().Cid())
+		}
+
+		for _, i := range []int{0, 1, len(txs) / 2, len(txs) - 2, len(txs) - 1} {
+			proof, err := BuildInclusionProof(nodes, txs[i])
+			if err != nil {
+				t.Fatalf("%s: tx %d: %s", fixture, i, err)
+			}
+
+			if proof.Index != uint32(i) || proof.TxCount != uint32(len(txs)) {
+				t.Fatalf("%s: expected index %d of %d, got %d of %d", fixture, i, len(txs), proof.Index, proof.TxCount)
+			}
+
+			if err := VerifyInclusionProof(proof, root); err != nil {
+				t.Fatalf("%s: tx %d: %s", fixture, i, err)
+			}
+
+			data, err := proof.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != 41+32*len(proof.Siblings) {
+				t.Fatalf("%s: unexpected proof size %d", fixture, len(data))
+			}
+
+			var decoded InclusionProof
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyInclusionProof(&decoded, root); err != nil {
+				t.Fatalf("%s: tx %d: decoded proof: %s", fixture, i, err)
+			}
+
+			if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+				t.Fatal("expected error decoding truncated proof")
+			}
+
+			decoded.Tx = txs[(i+1)%len(txs)]
+			if err := VerifyInclusionProof(&decoded, root); !errors.Is(err, ErrInvalidProof) {
+				t.Fatalf("%s: expected proof for another tx to fail, got %v", fixture, err)
+			}
+
+			decoded.Tx = proof.Tx
+			decoded.Index ^= 1 << uint(len(decoded.Siblings)-1)
+			if err := VerifyInclusionProof(&decoded, root); !errors.Is(err, ErrInvalidProof) {
+				t.Fatalf("%s: expected wrong index to fail, got %v", fixture, err)
+			}
+
+			decoded.Index = proof.TxCount
+			if err := VerifyInclusionProof(&decoded, root); !errors.Is(err, ErrInvalidProof) {
+				t.Fatalf("%s: expected an index past the last tx to fail, got %v", fixture, err)
+			}
+
+			decoded.Index = proof.Index
+			decoded.TxCount = proof.TxCount * 2
+			if err := VerifyInclusionProof(&decoded, root); !errors.Is(err, ErrInvalidProof) {
+				t.Fatalf("%s: expected a proof for a deeper tree to fail, got %v", fixture, err)
+			}
+		}
+
+		// the inner node above the first two transactions, with the rest
+		// of their path, leads to the root too, but is not a transaction
+		proof, err := BuildInclusionProof(nodes, txs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		inner := &TxTree{
+			Left:  &node.Link{Cid: txs[0]},
+			Right: &node.Link{Cid: proof.Siblings[0]},
+		}
+		fake := &InclusionProof{
+			Tx:       inner.Cid(),
+			Index:    0,
+			TxCount:  proof.TxCount,
+			Siblings: proof.Siblings[1:],
+		}
+		if err := VerifyInclusionProof(fake, root); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("%s: expected an inner node to be rejected, got %v", fixture, err)
+		}
+	}
+
+	// a block with a single transaction has the txid as merkle root
+	data, err := hex.DecodeString(txdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := DecodeTx(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := []node.Node{&Block{MerkleRoot: tx.Cid()}, tx}
+	proof, err := BuildInclusionProof(nodes, tx.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Siblings) != 0 || VerifyInclusionProof(proof, tx.Cid()) != nil {
+		t.Fatal("expected an empty proof for a single transaction block")
+	}
+
+	if _, err := BuildInclusionProof(nodes, hashToCid(make([]byte, 32), cid.BitcoinTx)); err == nil {
+		t.Fatal("expected error for a transaction not in the block")
+	}
+}
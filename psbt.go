@@ -0,0 +1,1525 @@
+package ipldbtc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// psbtMagic starts every serialized PSBT.
+var psbtMagic = []byte{'p', 's', 'b', 't', 0xff}
+
+// Key types of the global map of a PSBT, as registered by BIP174 and
+// BIP370.
+const (
+	PsbtGlobalUnsignedTx       = 0x00
+	PsbtGlobalXpub             = 0x01
+	PsbtGlobalTxVersion        = 0x02
+	PsbtGlobalFallbackLockTime = 0x03
+	PsbtGlobalInputCount       = 0x04
+	PsbtGlobalOutputCount      = 0x05
+	PsbtGlobalTxModifiable     = 0x06
+	PsbtGlobalVersion          = 0xfb
+	PsbtGlobalProprietary      = 0xfc
+)
+
+// Key types of the input maps of a PSBT, as registered by BIP174, BIP370
+// and BIP371.
+const (
+	PsbtInNonWitnessUtxo         = 0x00
+	PsbtInWitnessUtxo            = 0x01
+	PsbtInPartialSig             = 0x02
+	PsbtInSigHashType            = 0x03
+	PsbtInRedeemScript           = 0x04
+	PsbtInWitnessScript          = 0x05
+	PsbtInBip32Derivation        = 0x06
+	PsbtInFinalScriptSig         = 0x07
+	PsbtInFinalScriptWitness     = 0x08
+	PsbtInPorCommitment          = 0x09
+	PsbtInRipemd160              = 0x0a
+	PsbtInSha256                 = 0x0b
+	PsbtInHash160                = 0x0c
+	PsbtInHash256                = 0x0d
+	PsbtInPreviousTxid           = 0x0e
+	PsbtInOutputIndex            = 0x0f
+	PsbtInSequence               = 0x10
+	PsbtInRequiredTimeLockTime   = 0x11
+	PsbtInRequiredHeightLockTime = 0x12
+	PsbtInTapKeySig              = 0x13
+	PsbtInTapScriptSig           = 0x14
+	PsbtInTapLeafScript          = 0x15
+	PsbtInTapBip32Derivation     = 0x16
+	PsbtInTapInternalKey         = 0x17
+	PsbtInTapMerkleRoot          = 0x18
+	PsbtInProprietary            = 0xfc
+)
+
+// Key types of the output maps of a PSBT, as registered by BIP174, BIP370
+// and BIP371.
+const (
+	PsbtOutRedeemScript       = 0x00
+	PsbtOutWitnessScript      = 0x01
+	PsbtOutBip32Derivation    = 0x02
+	PsbtOutAmount             = 0x03
+	PsbtOutScript             = 0x04
+	PsbtOutTapInternalKey     = 0x05
+	PsbtOutTapTree            = 0x06
+	PsbtOutTapBip32Derivation = 0x07
+	PsbtOutProprietary        = 0xfc
+)
+
+// Psbt is a partially signed bitcoin transaction, in the version 0 format
+// of BIP174 or the version 2 format of BIP370. Each of its maps holds the
+// key-value pairs of the serialization, so that fields this package does
+// not know about survive decoding, combining and encoding.
+//
+// A Psbt is an IPLD node linking to the transaction it signs. It has no
+// multicodec of its own, so its CID is that of its serialization as a raw
+// block.
+type Psbt struct {
+	Global  PsbtMap
+	Inputs  []PsbtMap
+	Outputs []PsbtMap
+}
+
+// PsbtMap holds the key-value pairs of a map of a PSBT, keyed by the full
+// key: its compact size type followed by the key data.
+type PsbtMap map[string][]byte
+
+func psbtKey(keyType uint64, keyData []byte) string {
+	buf := new(bytes.Buffer)
+	writeVarInt(buf, keyType)
+	buf.Write(keyData)
+	return buf.String()
+}
+
+// splitPsbtKey returns the type and key data of a full key.
+func splitPsbtKey(key string) (uint64, []byte, error) {
+	if len(key) == 0 {
+		return 0, nil, fmt.Errorf("empty key")
+	}
+
+	b := []byte(key)
+	switch b[0] {
+	case 0xfd:
+		if len(b) < 3 {
+			return 0, nil, fmt.Errorf("truncated key type")
+		}
+		return uint64(binary.LittleEndian.Uint16(b[1:])), b[3:], nil
+	case 0xfe:
+		if len(b) < 5 {
+			return 0, nil, fmt.Errorf("truncated key type")
+		}
+		return uint64(binary.LittleEndian.Uint32(b[1:])), b[5:], nil
+	case 0xff:
+		if len(b) < 9 {
+			return 0, nil, fmt.Errorf("truncated key type")
+		}
+		return binary.LittleEndian.Uint64(b[1:]), b[9:], nil
+	default:
+		return uint64(b[0]), b[1:], nil
+	}
+}
+
+// Get returns the value of the key with the given type and key data.
+func (m PsbtMap) Get(keyType uint64, keyData []byte) ([]byte, bool) {
+	v, ok := m[psbtKey(keyType, keyData)]
+	return v, ok
+}
+
+// Set sets the value of the key with the given type and key data.
+func (m PsbtMap) Set(keyType uint64, keyData, value []byte) {
+	m[psbtKey(keyType, keyData)] = value
+}
+
+// Delete removes the key with the given type and key data.
+func (m PsbtMap) Delete(keyType uint64, keyData []byte) {
+	delete(m, psbtKey(keyType, keyData))
+}
+
+// KeyData returns the key data of every key of the given type, in order.
+func (m PsbtMap) KeyData(keyType uint64) [][]byte {
+	var out [][]byte
+	for _, k := range m.sortedKeys() {
+		t, data, err := splitPsbtKey(k)
+		if err == nil && t == keyType {
+			out = append(out, data)
+		}
+	}
+	return out
+}
+
+func (m PsbtMap) sortedKeys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m PsbtMap) copy() PsbtMap {
+	out := make(PsbtMap, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// psbtField describes a key type of a PSBT map.
+type psbtField struct {
+	name    string
+	keyType uint64
+
+	// keyed fields carry key data, and may appear once per key data
+	keyed bool
+
+	// version is the only PSBT version the field may appear in, or -1,
+	// and required whether it must appear in that version
+	version  int
+	required bool
+
+	// check validates the key data and value of the field; decode returns
+	// the value as it is resolved
+	check  func(keyData, value []byte) error
+	decode func(value []byte) (interface{}, error)
+}
+
+var psbtGlobalFields = []psbtField{
+	{name: "unsignedTx", keyType: PsbtGlobalUnsignedTx, version: 0, required: true, check: checkPsbtUnsignedTx, decode: decodePsbtTxLink},
+	{name: "xpubs", keyType: PsbtGlobalXpub, keyed: true, version: -1, check: checkPsbtXpub},
+	{name: "txVersion", keyType: PsbtGlobalTxVersion, version: 2, required: true, check: checkPsbtUint32, decode: decodePsbtUint32},
+	{name: "fallbackLockTime", keyType: PsbtGlobalFallbackLockTime, version: 2, check: checkPsbtUint32, decode: decodePsbtUint32},
+	{name: "inputCount", keyType: PsbtGlobalInputCount, version: 2, required: true, check: checkPsbtCount, decode: decodePsbtCount},
+	{name: "outputCount", keyType: PsbtGlobalOutputCount, version: 2, required: true, check: checkPsbtCount, decode: decodePsbtCount},
+	{name: "txModifiable", keyType: PsbtGlobalTxModifiable, version: 2, check: checkPsbtLength(1), decode: decodePsbtUint8},
+	{name: "version", keyType: PsbtGlobalVersion, version: -1, check: checkPsbtUint32, decode: decodePsbtUint32},
+	{name: "proprietary", keyType: PsbtGlobalProprietary, keyed: true, version: -1},
+}
+
+var psbtInputFields = []psbtField{
+	{name: "nonWitnessUtxo", keyType: PsbtInNonWitnessUtxo, version: -1, check: checkPsbtTx, decode: decodePsbtTxLink},
+	{name: "witnessUtxo", keyType: PsbtInWitnessUtxo, version: -1, check: checkPsbtTxOut, decode: decodePsbtTxOutValue},
+	{name: "partialSigs", keyType: PsbtInPartialSig, keyed: true, version: -1, check: checkPsbtPartialSig},
+	{name: "sighashType", keyType: PsbtInSigHashType, version: -1, check: checkPsbtUint32, decode: decodePsbtUint32},
+	{name: "redeemScript", keyType: PsbtInRedeemScript, version: -1, decode: decodePsbtScript},
+	{name: "witnessScript", keyType: PsbtInWitnessScript, version: -1, decode: decodePsbtScript},
+	{name: "bip32Derivation", keyType: PsbtInBip32Derivation, keyed: true, version: -1, check: checkPsbtBip32Derivation},
+	{name: "finalScriptSig", keyType: PsbtInFinalScriptSig, version: -1, decode: decodePsbtScript},
+	{name: "finalScriptWitness", keyType: PsbtInFinalScriptWitness, version: -1, check: checkPsbtWitness, decode: decodePsbtWitnessValue},
+	{name: "porCommitment", keyType: PsbtInPorCommitment, version: -1},
+	{name: "ripemd160", keyType: PsbtInRipemd160, keyed: true, version: -1, check: checkPsbtKeyLength(20)},
+	{name: "sha256", keyType: PsbtInSha256, keyed: true, version: -1, check: checkPsbtKeyLength(32)},
+	{name: "hash160", keyType: PsbtInHash160, keyed: true, version: -1, check: checkPsbtKeyLength(20)},
+	{name: "hash256", keyType: PsbtInHash256, keyed: true, version: -1, check: checkPsbtKeyLength(32)},
+	{name: "previousTxid", keyType: PsbtInPreviousTxid, version: 2, required: true, check: checkPsbtLength(32), decode: decodePsbtTxidLink},
+	{name: "outputIndex", keyType: PsbtInOutputIndex, version: 2, required: true, check: checkPsbtUint32, decode: decodePsbtUint32},
+	{name: "sequence", keyType: PsbtInSequence, version: 2, check: checkPsbtUint32, decode: decodePsbtUint32},
+	{name: "requiredTimeLockTime", keyType: PsbtInRequiredTimeLockTime, version: 2, check: checkPsbtTimeLockTime, decode: decodePsbtUint32},
+	{name: "requiredHeightLockTime", keyType: PsbtInRequiredHeightLockTime, version: 2, check: checkPsbtHeightLockTime, decode: decodePsbtUint32},
+	{name: "tapKeySig", keyType: PsbtInTapKeySig, version: -1, check: checkPsbtSchnorrSig},
+	{name: "tapScriptSigs", keyType: PsbtInTapScriptSig, keyed: true, version: -1, check: checkPsbtTapScriptSig},
+	{name: "tapLeafScripts", keyType: PsbtInTapLeafScript, keyed: true, version: -1, check: checkPsbtTapLeafScript},
+	{name: "tapBip32Derivation", keyType: PsbtInTapBip32Derivation, keyed: true, version: -1, check: checkPsbtTapBip32Derivation},
+	{name: "tapInternalKey", keyType: PsbtInTapInternalKey, version: -1, check: checkPsbtLength(32)},
+	{name: "tapMerkleRoot", keyType: PsbtInTapMerkleRoot, version: -1, check: checkPsbtLength(32)},
+	{name: "proprietary", keyType: PsbtInProprietary, keyed: true, version: -1},
+}
+
+var psbtOutputFields = []psbtField{
+	{name: "redeemScript", keyType: PsbtOutRedeemScript, version: -1, decode: decodePsbtScript},
+	{name: "witnessScript", keyType: PsbtOutWitnessScript, version: -1, decode: decodePsbtScript},
+	{name: "bip32Derivation", keyType: PsbtOutBip32Derivation, keyed: true, version: -1, check: checkPsbtBip32Derivation},
+	{name: "amount", keyType: PsbtOutAmount, version: 2, required: true, check: checkPsbtLength(8), decode: decodePsbtAmount},
+	{name: "script", keyType: PsbtOutScript, version: 2, required: true, decode: decodePsbtScript},
+	{name: "tapInternalKey", keyType: PsbtOutTapInternalKey, version: -1, check: checkPsbtLength(32)},
+	{name: "tapTree", keyType: PsbtOutTapTree, version: -1, check: checkPsbtTapTree},
+	{name: "tapBip32Derivation", keyType: PsbtOutTapBip32Derivation, keyed: true, version: -1, check: checkPsbtTapBip32Derivation},
+	{name: "proprietary", keyType: PsbtOutProprietary, keyed: true, version: -1},
+}
+
+func findPsbtField(fields []psbtField, keyType uint64) (psbtField, bool) {
+	for _, f := range fields {
+		if f.keyType == keyType {
+			return f, true
+		}
+	}
+	return psbtField{}, false
+}
+
+func findPsbtFieldName(fields []psbtField, name string) (psbtField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return psbtField{}, false
+}
+
+// NewPsbt returns a version 0 PSBT for signing tx, which must not carry
+// any signature scripts or witnesses yet.
+func NewPsbt(tx *Tx) (*Psbt, error) {
+	if tx.HasWitness() {
+		return nil, fmt.Errorf("%w: transaction has witnesses", ErrInvalidPsbt)
+	}
+	for i, inp := range tx.Inputs {
+		if len(inp.Script) != 0 {
+			return nil, fmt.Errorf("%w: input %d has a signature script", ErrInvalidPsbt, i)
+		}
+	}
+
+	p := &Psbt{Global: PsbtMap{}}
+	p.Global.Set(PsbtGlobalUnsignedTx, nil, tx.StrippedData())
+	for range tx.Inputs {
+		p.Inputs = append(p.Inputs, PsbtMap{})
+	}
+	for range tx.Outputs {
+		p.Outputs = append(p.Outputs, PsbtMap{})
+	}
+	return p, nil
+}
+
+// DecodePsbt decodes a serialized PSBT, checking the fields it knows
+// about.
+func DecodePsbt(b []byte) (*Psbt, error) {
+	r := newReader(bufio.NewReader(bytes.NewReader(b)))
+	magic, err := readFixedSlice(r, "magic", len(psbtMagic))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, psbtMagic) {
+		return nil, fmt.Errorf("%w: bad magic bytes", ErrInvalidPsbt)
+	}
+
+	global, err := readPsbtMap(r)
+	if err != nil {
+		return nil, prefixField(err, "global.")
+	}
+	p := &Psbt{Global: global}
+
+	var nIn, nOut int
+	switch v := p.Version(); v {
+	case 0:
+		tx, err := p.UnsignedTx()
+		if err != nil {
+			return nil, err
+		}
+		nIn, nOut = len(tx.Inputs), len(tx.Outputs)
+	case 2:
+		// the counts are needed to read the maps that follow, so the
+		// global fields are checked first
+		if err := checkPsbtMap(global, psbtGlobalFields, v); err != nil {
+			return nil, fmt.Errorf("global: %w", err)
+		}
+		inCount, _ := global.Get(PsbtGlobalInputCount, nil)
+		outCount, _ := global.Get(PsbtGlobalOutputCount, nil)
+		n, err := decodePsbtCount(inCount)
+		if err != nil {
+			return nil, fmt.Errorf("%w: inputCount: %s", ErrInvalidPsbt, err)
+		}
+		nIn = int(n.(uint64))
+		n, err = decodePsbtCount(outCount)
+		if err != nil {
+			return nil, fmt.Errorf("%w: outputCount: %s", ErrInvalidPsbt, err)
+		}
+		nOut = int(n.(uint64))
+	default:
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidPsbt, v)
+	}
+
+	for i := 0; i < nIn; i++ {
+		m, err := readPsbtMap(r)
+		if err != nil {
+			return nil, prefixField(err, fmt.Sprintf("input[%d].", i))
+		}
+		p.Inputs = append(p.Inputs, m)
+	}
+	for i := 0; i < nOut; i++ {
+		m, err := readPsbtMap(r)
+		if err != nil {
+			return nil, prefixField(err, fmt.Sprintf("output[%d].", i))
+		}
+		p.Outputs = append(p.Outputs, m)
+	}
+
+	if _, err := r.br.ReadByte(); err == nil {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidPsbt)
+	}
+
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DecodePsbtBase64 decodes a PSBT in the base64 encoding used to pass them
+// between wallets.
+func DecodePsbtBase64(s string) (*Psbt, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPsbt, err)
+	}
+	return DecodePsbt(b)
+}
+
+// readPsbtMap reads key-value pairs up to the zero length key ending the
+// map.
+func readPsbtMap(r *reader) (PsbtMap, error) {
+	m := PsbtMap{}
+	for {
+		key, err := readVarSlice(r, "key")
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return m, nil
+		}
+
+		if _, _, err := splitPsbtKey(string(key)); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPsbt, err)
+		}
+		if _, ok := m[string(key)]; ok {
+			return nil, fmt.Errorf("%w: duplicate key %x", ErrInvalidPsbt, key)
+		}
+
+		value, err := readVarSlice(r, "value")
+		if err != nil {
+			return nil, err
+		}
+		m[string(key)] = value
+	}
+}
+
+// check validates the fields of every map against the PSBT version.
+func (p *Psbt) check() error {
+	version := p.Version()
+	if err := checkPsbtMap(p.Global, psbtGlobalFields, version); err != nil {
+		return fmt.Errorf("global: %w", err)
+	}
+	for i, m := range p.Inputs {
+		if err := checkPsbtMap(m, psbtInputFields, version); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	for i, m := range p.Outputs {
+		if err := checkPsbtMap(m, psbtOutputFields, version); err != nil {
+			return fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+
+	tx, err := p.unsignedTx()
+	if err != nil {
+		return err
+	}
+	for i, m := range p.Inputs {
+		raw, ok := m.Get(PsbtInNonWitnessUtxo, nil)
+		if !ok {
+			continue
+		}
+		prev, _ := DecodeTx(raw)
+		if !prev.Stripped().Cid().Equals(tx.Inputs[i].PrevTx) {
+			return fmt.Errorf("%w: input %d: non-witness utxo does not match the spent transaction", ErrInvalidPsbt, i)
+		}
+	}
+	return nil
+}
+
+func checkPsbtMap(m PsbtMap, fields []psbtField, version int) error {
+	for key, value := range m {
+		keyType, keyData, err := splitPsbtKey(key)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPsbt, err)
+		}
+
+		f, ok := findPsbtField(fields, keyType)
+		if !ok {
+			continue
+		}
+		if f.version >= 0 && f.version != version {
+			return fmt.Errorf("%w: %s in a version %d psbt", ErrInvalidPsbt, f.name, version)
+		}
+		if !f.keyed && len(keyData) != 0 {
+			return fmt.Errorf("%w: %s with key data", ErrInvalidPsbt, f.name)
+		}
+		if f.check != nil {
+			if err := f.check(keyData, value); err != nil {
+				return fmt.Errorf("%w: %s: %s", ErrInvalidPsbt, f.name, err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if f.required && f.version == version {
+			if _, ok := m.Get(f.keyType, nil); !ok {
+				return fmt.Errorf("%w: missing %s", ErrInvalidPsbt, f.name)
+			}
+		}
+	}
+	return nil
+}
+
+func checkPsbtLength(n int) func(keyData, value []byte) error {
+	return func(keyData, value []byte) error {
+		if len(value) != n {
+			return fmt.Errorf("value of %d bytes, expected %d", len(value), n)
+		}
+		return nil
+	}
+}
+
+func checkPsbtKeyLength(n int) func(keyData, value []byte) error {
+	return func(keyData, value []byte) error {
+		if len(keyData) != n {
+			return fmt.Errorf("key data of %d bytes, expected %d", len(keyData), n)
+		}
+		return nil
+	}
+}
+
+func checkPsbtUint32(keyData, value []byte) error {
+	return checkPsbtLength(4)(keyData, value)
+}
+
+func checkPsbtCount(keyData, value []byte) error {
+	r := newReader(bufio.NewReader(bytes.NewReader(value)))
+	if _, err := readVarint(r, "count"); err != nil {
+		return err
+	}
+	if r.off != int64(len(value)) {
+		return fmt.Errorf("trailing data after count")
+	}
+	return nil
+}
+
+func checkPsbtTimeLockTime(keyData, value []byte) error {
+	if err := checkPsbtUint32(keyData, value); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(value) < lockTimeThreshold {
+		return fmt.Errorf("time lock below %d", lockTimeThreshold)
+	}
+	return nil
+}
+
+func checkPsbtHeightLockTime(keyData, value []byte) error {
+	if err := checkPsbtUint32(keyData, value); err != nil {
+		return err
+	}
+	if h := binary.LittleEndian.Uint32(value); h == 0 || h >= lockTimeThreshold {
+		return fmt.Errorf("invalid height lock %d", h)
+	}
+	return nil
+}
+
+// checkPsbtUnsignedTx checks that the unsigned transaction is serialized
+// without witnesses and has no signatures.
+func checkPsbtUnsignedTx(keyData, value []byte) error {
+	tx, err := DecodeTx(value)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tx.StrippedData(), value) {
+		return fmt.Errorf("not in the non-witness serialization")
+	}
+	for i, inp := range tx.Inputs {
+		if len(inp.Script) != 0 {
+			return fmt.Errorf("input %d has a signature script", i)
+		}
+	}
+	return nil
+}
+
+func checkPsbtTx(keyData, value []byte) error {
+	tx, err := DecodeTx(value)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tx.RawData(), value) {
+		return fmt.Errorf("trailing data after transaction")
+	}
+	return nil
+}
+
+func checkPsbtTxOut(keyData, value []byte) error {
+	_, err := decodePsbtTxOut(value)
+	return err
+}
+
+func checkPsbtWitness(keyData, value []byte) error {
+	_, err := decodePsbtWitness(value)
+	return err
+}
+
+func checkPsbtPubKey(keyData, value []byte) error {
+	if _, err := btcec.ParsePubKey(keyData); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkPsbtPartialSig checks a partial signature: an ECDSA signature in
+// strict DER followed by its sighash type, keyed by a valid public key.
+func checkPsbtPartialSig(keyData, value []byte) error {
+	if err := checkPsbtPubKey(keyData, value); err != nil {
+		return err
+	}
+	if !isValidSignatureEncoding(value) {
+		return fmt.Errorf("partial signature is not DER encoded")
+	}
+	return nil
+}
+
+func checkPsbtXpub(keyData, value []byte) error {
+	if len(keyData) != 78 {
+		return fmt.Errorf("extended key of %d bytes", len(keyData))
+	}
+	return checkPsbtKeyPath(value)
+}
+
+// checkPsbtKeyPath checks a key origin: a fingerprint followed by the
+// derivation path indices.
+func checkPsbtKeyPath(value []byte) error {
+	if len(value) < 4 || len(value)%4 != 0 {
+		return fmt.Errorf("key origin of %d bytes", len(value))
+	}
+	return nil
+}
+
+func checkPsbtBip32Derivation(keyData, value []byte) error {
+	if err := checkPsbtPubKey(keyData, value); err != nil {
+		return err
+	}
+	return checkPsbtKeyPath(value)
+}
+
+func checkPsbtSchnorrSig(keyData, value []byte) error {
+	if len(value) != 64 && len(value) != 65 {
+		return fmt.Errorf("schnorr signature of %d bytes", len(value))
+	}
+	return nil
+}
+
+func checkPsbtTapScriptSig(keyData, value []byte) error {
+	if len(keyData) != 64 {
+		return fmt.Errorf("key data of %d bytes, expected an x-only key and leaf hash", len(keyData))
+	}
+	return checkPsbtSchnorrSig(keyData, value)
+}
+
+func checkPsbtTapLeafScript(keyData, value []byte) error {
+	if _, err := ParseControlBlock(keyData); err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return fmt.Errorf("missing leaf version")
+	}
+	return nil
+}
+
+func checkPsbtTapBip32Derivation(keyData, value []byte) error {
+	if len(keyData) != 32 {
+		return fmt.Errorf("x-only key of %d bytes", len(keyData))
+	}
+
+	r := newReader(bufio.NewReader(bytes.NewReader(value)))
+	n, err := readVarint(r, "leaf_hash_count")
+	if err != nil {
+		return err
+	}
+	if int64(n)*32 > int64(len(value))-r.off {
+		return fmt.Errorf("truncated leaf hashes")
+	}
+	return checkPsbtKeyPath(value[r.off+int64(n)*32:])
+}
+
+// checkPsbtTapTree checks the depth first list of leaves of a taproot
+// output: depth, leaf version and script of each.
+func checkPsbtTapTree(keyData, value []byte) error {
+	if len(value) == 0 {
+		return fmt.Errorf("empty tree")
+	}
+
+	r := newReader(bufio.NewReader(bytes.NewReader(value)))
+	for r.off < int64(len(value)) {
+		hdr, err := readFixedSlice(r, "leaf", 2)
+		if err != nil {
+			return err
+		}
+		if hdr[0] > maxTaprootPathLen {
+			return fmt.Errorf("leaf depth %d", hdr[0])
+		}
+		if _, err := readVarSlice(r, "script"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodePsbtUint32(value []byte) (interface{}, error) {
+	if len(value) != 4 {
+		return nil, fmt.Errorf("value of %d bytes, expected 4", len(value))
+	}
+	return binary.LittleEndian.Uint32(value), nil
+}
+
+func decodePsbtUint8(value []byte) (interface{}, error) {
+	if len(value) != 1 {
+		return nil, fmt.Errorf("value of %d bytes, expected 1", len(value))
+	}
+	return value[0], nil
+}
+
+func decodePsbtCount(value []byte) (interface{}, error) {
+	r := newReader(bufio.NewReader(bytes.NewReader(value)))
+	n, err := readVarint(r, "count")
+	if err != nil {
+		return nil, err
+	}
+	return uint64(n), nil
+}
+
+func decodePsbtAmount(value []byte) (interface{}, error) {
+	if len(value) != 8 {
+		return nil, fmt.Errorf("value of %d bytes, expected 8", len(value))
+	}
+	return int64(binary.LittleEndian.Uint64(value)), nil
+}
+
+func decodePsbtScript(value []byte) (interface{}, error) {
+	return Script(value), nil
+}
+
+func decodePsbtTxLink(value []byte) (interface{}, error) {
+	tx, err := DecodeTx(value)
+	if err != nil {
+		return nil, err
+	}
+	return &node.Link{Cid: tx.Cid()}, nil
+}
+
+func decodePsbtTxidLink(value []byte) (interface{}, error) {
+	return &node.Link{Cid: hashToCid(value, cid.BitcoinTx)}, nil
+}
+
+func decodePsbtTxOutValue(value []byte) (interface{}, error) {
+	return decodePsbtTxOut(value)
+}
+
+func decodePsbtWitnessValue(value []byte) (interface{}, error) {
+	return decodePsbtWitness(value)
+}
+
+func decodePsbtTxOut(value []byte) (*TxOut, error) {
+	r := newReader(bufio.NewReader(bytes.NewReader(value)))
+	out, err := parseTxOut(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.off != int64(len(value)) {
+		return nil, fmt.Errorf("trailing data after output")
+	}
+	return out, nil
+}
+
+func decodePsbtWitness(value []byte) ([][]byte, error) {
+	r := newReader(bufio.NewReader(bytes.NewReader(value)))
+	wits, err := readTxWitnesses(r, 1)
+	if err != nil {
+		return nil, err
+	}
+	if r.off != int64(len(value)) {
+		return nil, fmt.Errorf("trailing data after witness")
+	}
+	return wits[0].Data, nil
+}
+
+// Version returns the PSBT version, 0 unless the global map says
+// otherwise.
+func (p *Psbt) Version() int {
+	v, ok := p.Global.Get(PsbtGlobalVersion, nil)
+	if !ok || len(v) != 4 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(v))
+}
+
+// UnsignedTx returns the transaction being signed, without signature
+// scripts or witnesses: the global unsigned transaction of a version 0
+// PSBT, or the one described by the fields of a version 2 PSBT.
+func (p *Psbt) UnsignedTx() (*Tx, error) {
+	tx, err := p.unsignedTx()
+	if err != nil || p.Version() != 2 {
+		return tx, err
+	}
+
+	tx.LockTime, err = p.lockTime()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// unsignedTx returns the transaction being signed, without the lock time
+// of a version 2 PSBT, which is only known once its inputs agree on one.
+func (p *Psbt) unsignedTx() (*Tx, error) {
+	if p.Version() != 2 {
+		raw, ok := p.Global.Get(PsbtGlobalUnsignedTx, nil)
+		if !ok {
+			return nil, fmt.Errorf("%w: missing unsigned transaction", ErrInvalidPsbt)
+		}
+		if err := checkPsbtUnsignedTx(nil, raw); err != nil {
+			return nil, fmt.Errorf("%w: unsignedTx: %s", ErrInvalidPsbt, err)
+		}
+		return DecodeTx(raw)
+	}
+
+	version, ok := p.Global.Get(PsbtGlobalTxVersion, nil)
+	if !ok || len(version) != 4 {
+		return nil, fmt.Errorf("%w: missing txVersion", ErrInvalidPsbt)
+	}
+	tx := &Tx{Version: binary.LittleEndian.Uint32(version)}
+
+	for i, m := range p.Inputs {
+		txid, ok1 := m.Get(PsbtInPreviousTxid, nil)
+		index, ok2 := m.Get(PsbtInOutputIndex, nil)
+		if !ok1 || !ok2 || len(txid) != 32 || len(index) != 4 {
+			return nil, fmt.Errorf("%w: input %d: missing previousTxid or outputIndex", ErrInvalidPsbt, i)
+		}
+
+		inp := &TxIn{
+			PrevTx:      hashToCid(txid, cid.BitcoinTx),
+			PrevTxIndex: binary.LittleEndian.Uint32(index),
+			Script:      Script{},
+			SeqNo:       SequenceFinal,
+		}
+		if seq, ok := m.Get(PsbtInSequence, nil); ok && len(seq) == 4 {
+			inp.SeqNo = binary.LittleEndian.Uint32(seq)
+		}
+		tx.Inputs = append(tx.Inputs, inp)
+	}
+
+	for i, m := range p.Outputs {
+		amount, ok1 := m.Get(PsbtOutAmount, nil)
+		script, ok2 := m.Get(PsbtOutScript, nil)
+		if !ok1 || !ok2 || len(amount) != 8 {
+			return nil, fmt.Errorf("%w: output %d: missing amount or script", ErrInvalidPsbt, i)
+		}
+		tx.Outputs = append(tx.Outputs, &TxOut{Value: binary.LittleEndian.Uint64(amount), Script: script})
+	}
+	return tx, nil
+}
+
+// lockTime determines the lock time of a version 2 PSBT following BIP370:
+// the largest height or time required by an input, preferring heights when
+// every input with a requirement allows one, or else the fallback.
+func (p *Psbt) lockTime() (uint32, error) {
+	var heights, times, constrained int
+	var height, time uint32
+	for _, m := range p.Inputs {
+		h, hasHeight := m.Get(PsbtInRequiredHeightLockTime, nil)
+		t, hasTime := m.Get(PsbtInRequiredTimeLockTime, nil)
+		if !hasHeight && !hasTime {
+			continue
+		}
+
+		constrained++
+		if hasHeight && len(h) == 4 {
+			heights++
+			if v := binary.LittleEndian.Uint32(h); v > height {
+				height = v
+			}
+		}
+		if hasTime && len(t) == 4 {
+			times++
+			if v := binary.LittleEndian.Uint32(t); v > time {
+				time = v
+			}
+		}
+	}
+
+	switch {
+	case constrained == 0:
+		if v, ok := p.Global.Get(PsbtGlobalFallbackLockTime, nil); ok && len(v) == 4 {
+			return binary.LittleEndian.Uint32(v), nil
+		}
+		return 0, nil
+	case heights == constrained:
+		return height, nil
+	case times == constrained:
+		return time, nil
+	default:
+		return 0, fmt.Errorf("%w: inputs require both a height and a time lock", ErrInvalidPsbt)
+	}
+}
+
+// spentOutput returns the output spent by input i, from its witness or
+// non-witness UTXO, or nil if the PSBT does not hold it.
+func (p *Psbt) spentOutput(i int, tx *Tx) (*TxOut, error) {
+	m := p.Inputs[i]
+	if raw, ok := m.Get(PsbtInWitnessUtxo, nil); ok {
+		return decodePsbtTxOut(raw)
+	}
+
+	raw, ok := m.Get(PsbtInNonWitnessUtxo, nil)
+	if !ok {
+		return nil, nil
+	}
+	prev, err := DecodeTx(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	index := tx.Inputs[i].PrevTxIndex
+	if int(index) >= len(prev.Outputs) {
+		return nil, fmt.Errorf("%w: input %d spends output %d of a transaction with %d", ErrInvalidPsbt, i, index, len(prev.Outputs))
+	}
+	return prev.Outputs[index], nil
+}
+
+// Combine adds the key-value pairs of others to p, as the BIP174 combiner
+// does. All must be PSBTs of the same version for the same transaction.
+// Where they hold different values for a key, the value of p is kept.
+func (p *Psbt) Combine(others ...*Psbt) error {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range others {
+		otx, err := o.UnsignedTx()
+		if err != nil {
+			return err
+		}
+		if o.Version() != p.Version() || !otx.Cid().Equals(tx.Cid()) ||
+			len(o.Inputs) != len(p.Inputs) || len(o.Outputs) != len(p.Outputs) {
+			return fmt.Errorf("%w: cannot combine psbts of different transactions", ErrInvalidPsbt)
+		}
+	}
+
+	for _, o := range others {
+		combinePsbtMap(p.Global, o.Global)
+		for i, m := range o.Inputs {
+			combinePsbtMap(p.Inputs[i], m)
+		}
+		for i, m := range o.Outputs {
+			combinePsbtMap(p.Outputs[i], m)
+		}
+	}
+	return nil
+}
+
+func combinePsbtMap(dst, src PsbtMap) {
+	for k, v := range src {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+}
+
+// Finalize builds the final signature script and witness of every input
+// that is not final yet, as the BIP174 input finalizer does. It knows how
+// to satisfy P2PK, P2PKH and multisig scripts, bare or wrapped in P2SH,
+// P2WSH or both, P2WPKH, taproot key path spends and tapscript leaves
+// checking one key or several with OP_CHECKSIGADD. Finalized inputs are
+// verified against the outputs they spend and cleared of the fields only
+// needed for signing.
+//
+// Inputs lacking the data to be finalized are left as they are, and the
+// first of them is reported in the returned error.
+func (p *Psbt) Finalize() error {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+
+	prevOuts := make([]*TxOut, len(p.Inputs))
+	for i := range p.Inputs {
+		prevOuts[i], err = p.spentOutput(i, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var firstErr error
+	for i := range p.Inputs {
+		if err := p.finalizeInput(i, tx, prevOuts); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	return firstErr
+}
+
+func (p *Psbt) finalizeInput(i int, tx *Tx, prevOuts []*TxOut) error {
+	m := p.Inputs[i]
+	_, hasSigScript := m.Get(PsbtInFinalScriptSig, nil)
+	_, hasWitness := m.Get(PsbtInFinalScriptWitness, nil)
+	if hasSigScript || hasWitness {
+		return nil
+	}
+
+	prevOut := prevOuts[i]
+	if prevOut == nil {
+		return fmt.Errorf("no utxo for input")
+	}
+
+	if err := checkPsbtSigHashTypes(m); err != nil {
+		return err
+	}
+
+	sigScript, witness, err := satisfyPsbtInput(m, prevOut.Script)
+	if err != nil {
+		return err
+	}
+
+	// verify the spend before recording it
+	vtx := *tx
+	vtx.Inputs = append([]*TxIn(nil), tx.Inputs...)
+	in := *tx.Inputs[i]
+	in.Script = sigScript
+	vtx.Inputs[i] = &in
+	vtx.Witnesses = make([]*Witness, len(tx.Inputs))
+	for j := range vtx.Witnesses {
+		vtx.Witnesses[j] = &Witness{}
+	}
+	vtx.Witnesses[i] = &Witness{Data: witness}
+	if err := vtx.verifyInput(i, prevOuts, ConsensusVerifyFlags); err != nil {
+		return err
+	}
+
+	// keep the UTXOs, the fields defining a version 2 transaction and any
+	// field the finalizer does not understand
+	for key := range m {
+		keyType, _, _ := splitPsbtKey(key)
+		switch keyType {
+		case PsbtInNonWitnessUtxo, PsbtInWitnessUtxo, PsbtInPorCommitment, PsbtInProprietary,
+			PsbtInPreviousTxid, PsbtInOutputIndex, PsbtInSequence,
+			PsbtInRequiredTimeLockTime, PsbtInRequiredHeightLockTime:
+			continue
+		}
+		if _, ok := findPsbtField(psbtInputFields, keyType); ok {
+			delete(m, key)
+		}
+	}
+
+	if len(sigScript) > 0 {
+		m.Set(PsbtInFinalScriptSig, nil, sigScript)
+	}
+	if len(witness) > 0 {
+		buf := new(bytes.Buffer)
+		(&Witness{Data: witness}).WriteTo(buf)
+		m.Set(PsbtInFinalScriptWitness, nil, buf.Bytes())
+	}
+	return nil
+}
+
+// checkPsbtSigHashTypes checks that every signature of the input uses the
+// sighash type it requests, if any.
+func checkPsbtSigHashTypes(m PsbtMap) error {
+	v, ok := m.Get(PsbtInSigHashType, nil)
+	if !ok || len(v) != 4 {
+		return nil
+	}
+	hashType := binary.LittleEndian.Uint32(v)
+
+	check := func(sig []byte, schnorr bool) error {
+		if len(sig) == 0 {
+			return fmt.Errorf("empty signature")
+		}
+
+		got := uint32(SigHashDefault)
+		if !schnorr || len(sig) == 65 {
+			got = uint32(sig[len(sig)-1])
+		}
+		if got != hashType {
+			return fmt.Errorf("signature does not use sighash type %#x", hashType)
+		}
+		return nil
+	}
+
+	for _, k := range m.KeyData(PsbtInPartialSig) {
+		sig, _ := m.Get(PsbtInPartialSig, k)
+		if err := check(sig, false); err != nil {
+			return err
+		}
+	}
+	if sig, ok := m.Get(PsbtInTapKeySig, nil); ok {
+		if err := check(sig, true); err != nil {
+			return err
+		}
+	}
+	for _, k := range m.KeyData(PsbtInTapScriptSig) {
+		sig, _ := m.Get(PsbtInTapScriptSig, k)
+		if err := check(sig, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// satisfyPsbtInput builds the signature script and witness spending
+// script with the signatures and scripts of the input map.
+func satisfyPsbtInput(m PsbtMap, script Script) (Script, [][]byte, error) {
+	var redeem []byte
+	if script.Class() == P2SH {
+		var ok bool
+		redeem, ok = m.Get(PsbtInRedeemScript, nil)
+		if !ok {
+			return nil, nil, fmt.Errorf("missing redeem script")
+		}
+		if !bytes.Equal(hash160(redeem), script[2:22]) {
+			return nil, nil, fmt.Errorf("redeem script does not match the output script")
+		}
+		script = redeem
+	}
+
+	var stack, witness [][]byte
+	var err error
+	switch script.Class() {
+	case P2WPKH:
+		witness, err = satisfyPsbtScript(m, pubKeyHashScript(script[2:22]))
+	case P2WSH:
+		ws, ok := m.Get(PsbtInWitnessScript, nil)
+		if !ok {
+			return nil, nil, fmt.Errorf("missing witness script")
+		}
+		if !bytes.Equal(sha256Sum(ws), script[2:34]) {
+			return nil, nil, fmt.Errorf("witness script does not match the output script")
+		}
+		witness, err = satisfyPsbtScript(m, ws)
+		witness = append(witness, ws)
+	case P2TR:
+		if redeem != nil {
+			return nil, nil, fmt.Errorf("taproot output wrapped in P2SH")
+		}
+		witness, err = satisfyPsbtTaproot(m)
+	default:
+		stack, err = satisfyPsbtScript(m, script)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sigScript Script
+	for _, item := range stack {
+		sigScript = append(sigScript, pushScript(item)...)
+	}
+	if redeem != nil {
+		sigScript = append(sigScript, pushScript(redeem)...)
+	}
+	return sigScript, witness, nil
+}
+
+// satisfyPsbtScript returns the stack satisfying a P2PK, P2PKH or multisig
+// script with the partial signatures of the input map.
+func satisfyPsbtScript(m PsbtMap, script Script) ([][]byte, error) {
+	switch script.Class() {
+	case P2PK:
+		ops, _ := script.Ops()
+		if sig, ok := m.Get(PsbtInPartialSig, ops[0].Data); ok {
+			return [][]byte{sig}, nil
+		}
+	case P2PKH:
+		for _, pubKey := range m.KeyData(PsbtInPartialSig) {
+			if bytes.Equal(hash160(pubKey), script[3:23]) {
+				sig, _ := m.Get(PsbtInPartialSig, pubKey)
+				return [][]byte{sig, pubKey}, nil
+			}
+		}
+	case MultiSig:
+		ops, _ := script.Ops()
+		required := smallInt(ops[0].Opcode)
+
+		// the dummy element consumed by OP_CHECKMULTISIG, then signatures in
+		// the order of their keys
+		stack := [][]byte{{}}
+		for _, op := range ops[1 : len(ops)-2] {
+			if sig, ok := m.Get(PsbtInPartialSig, op.Data); ok && len(stack) <= required {
+				stack = append(stack, sig)
+			}
+		}
+		if len(stack) > required {
+			return stack, nil
+		}
+	default:
+		return nil, fmt.Errorf("cannot satisfy %s script", script.Class())
+	}
+	return nil, fmt.Errorf("missing signatures")
+}
+
+// satisfyPsbtTaproot returns the witness of a taproot key path spend if
+// the key path signature is known, or else of the first script path that
+// can be satisfied.
+func satisfyPsbtTaproot(m PsbtMap) ([][]byte, error) {
+	if sig, ok := m.Get(PsbtInTapKeySig, nil); ok {
+		return [][]byte{sig}, nil
+	}
+
+	for _, cb := range m.KeyData(PsbtInTapLeafScript) {
+		v, _ := m.Get(PsbtInTapLeafScript, cb)
+		script, leafVersion := Script(v[:len(v)-1]), v[len(v)-1]
+		if leafVersion != TapscriptLeafVersion {
+			continue
+		}
+
+		leafHash := TapLeafHash(leafVersion, script)
+		if stack, ok := satisfyPsbtTapscript(m, script, leafHash); ok {
+			return append(stack, script, cb), nil
+		}
+	}
+	return nil, fmt.Errorf("missing signatures")
+}
+
+// satisfyPsbtTapscript satisfies a leaf checking one key with
+// OP_CHECKSIG, or k of n keys with OP_CHECKSIG, OP_CHECKSIGADD and
+// OP_NUMEQUAL.
+func satisfyPsbtTapscript(m PsbtMap, script Script, leafHash []byte) ([][]byte, bool) {
+	ops, err := script.Ops()
+	if err != nil || len(ops) < 2 {
+		return nil, false
+	}
+
+	var keys [][]byte
+	required := 1
+	switch {
+	case len(ops) == 2:
+		if len(ops[0].Data) != 32 || ops[1].Opcode != OpCheckSig {
+			return nil, false
+		}
+		keys = [][]byte{ops[0].Data}
+	case len(ops)%2 == 0:
+		last := len(ops) - 1
+		n := int64(smallInt(ops[last-1].Opcode))
+		if !isSmallInt(ops[last-1].Opcode) {
+			n, err = parseScriptNum(ops[last-1].Data, true, 4)
+		}
+		if err != nil || ops[last].Opcode != OpNumEqual || n < 1 {
+			return nil, false
+		}
+		required = int(n)
+		for j := 0; j < last-1; j += 2 {
+			expected := OpCheckSigAdd
+			if j == 0 {
+				expected = OpCheckSig
+			}
+			if len(ops[j].Data) != 32 || ops[j+1].Opcode != expected {
+				return nil, false
+			}
+			keys = append(keys, ops[j].Data)
+		}
+	default:
+		return nil, false
+	}
+
+	// the first key checks the signature on top of the stack, so
+	// signatures are listed in reverse order, empty for unused keys
+	var found int
+	stack := make([][]byte, len(keys))
+	for j, key := range keys {
+		stack[len(keys)-1-j] = []byte{}
+		if found == required {
+			continue
+		}
+		if sig, ok := m.Get(PsbtInTapScriptSig, append(append([]byte{}, key...), leafHash...)); ok {
+			stack[len(keys)-1-j] = sig
+			found++
+		}
+	}
+	return stack, found == required
+}
+
+// Extract returns the network transaction of a PSBT whose inputs are all
+// final, as the BIP174 transaction extractor does.
+func (p *Psbt) Extract() (*Tx, error) {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return nil, err
+	}
+
+	witnesses := make([]*Witness, len(tx.Inputs))
+	for i, m := range p.Inputs {
+		sigScript, hasSigScript := m.Get(PsbtInFinalScriptSig, nil)
+		rawWitness, hasWitness := m.Get(PsbtInFinalScriptWitness, nil)
+		if !hasSigScript && !hasWitness {
+			return nil, fmt.Errorf("%w: input %d is not final", ErrInvalidPsbt, i)
+		}
+
+		tx.Inputs[i].Script = Script(sigScript)
+		if tx.Inputs[i].Script == nil {
+			tx.Inputs[i].Script = Script{}
+		}
+
+		witnesses[i] = &Witness{Data: [][]byte{}}
+		if hasWitness {
+			witnesses[i].Data, err = decodePsbtWitness(rawWitness)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tx.Witnesses = witnesses
+	if !tx.HasWitness() {
+		tx.Witnesses = nil
+	}
+	return tx, nil
+}
+
+// RawData returns the serialization of the PSBT, with the keys of each map
+// in lexicographic order.
+func (p *Psbt) RawData() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(psbtMagic)
+	writePsbtMap(buf, p.Global)
+	for _, m := range p.Inputs {
+		writePsbtMap(buf, m)
+	}
+	for _, m := range p.Outputs {
+		writePsbtMap(buf, m)
+	}
+	return buf.Bytes()
+}
+
+func writePsbtMap(buf *bytes.Buffer, m PsbtMap) {
+	for _, k := range m.sortedKeys() {
+		writeVarInt(buf, uint64(len(k)))
+		buf.WriteString(k)
+		writeVarInt(buf, uint64(len(m[k])))
+		buf.Write(m[k])
+	}
+	buf.WriteByte(0)
+}
+
+// Base64 returns the base64 encoding of the serialized PSBT.
+func (p *Psbt) Base64() string {
+	return base64.StdEncoding.EncodeToString(p.RawData())
+}
+
+// Cid returns the CID of the serialized PSBT as a raw block.
+func (p *Psbt) Cid() cid.Cid {
+	h, _ := mh.Sum(p.RawData(), mh.SHA2_256, -1)
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+// Links returns the link to the transaction being signed, and to the
+// transactions holding the outputs spent by inputs with non-witness UTXOs.
+func (p *Psbt) Links() []*node.Link {
+	var out []*node.Link
+	if tx, err := p.UnsignedTx(); err == nil {
+		out = append(out, &node.Link{Name: "tx", Cid: tx.Cid()})
+	}
+
+	for i, m := range p.Inputs {
+		raw, ok := m.Get(PsbtInNonWitnessUtxo, nil)
+		if !ok {
+			continue
+		}
+		if prev, err := DecodeTx(raw); err == nil {
+			out = append(out, &node.Link{Name: fmt.Sprintf("inputs/%d/nonWitnessUtxo", i), Cid: prev.Cid()})
+		}
+	}
+	return out
+}
+
+func (p *Psbt) Loggable() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "bitcoin_psbt",
+	}
+}
+
+// Resolve resolves "tx", the link to the transaction being signed, the
+// fields of the global map by name, such as "version" or "xpubs/<key>",
+// and those of "inputs/<n>" and "outputs/<n>", such as
+// "inputs/0/partialSigs/<pubkey>". Key data is given in hex.
+func (p *Psbt) Resolve(path []string) (interface{}, []string, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("zero length path")
+	}
+
+	switch path[0] {
+	case "tx":
+		tx, err := p.UnsignedTx()
+		if err != nil {
+			return nil, nil, err
+		}
+		return &node.Link{Cid: tx.Cid()}, path[1:], nil
+	case "version":
+		return uint32(p.Version()), path[1:], nil
+	case "inputs", "outputs":
+		maps, fields := p.Inputs, psbtInputFields
+		if path[0] == "outputs" {
+			maps, fields = p.Outputs, psbtOutputFields
+		}
+		if len(path) == 1 {
+			return maps, nil, nil
+		}
+
+		index, err := strconv.Atoi(path[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		if index >= len(maps) || index < 0 {
+			return nil, nil, fmt.Errorf("index out of range")
+		}
+		if len(path) == 2 {
+			return maps[index], nil, nil
+		}
+		return resolvePsbtMap(maps[index], fields, path[2:])
+	default:
+		return resolvePsbtMap(p.Global, psbtGlobalFields, path)
+	}
+}
+
+func resolvePsbtMap(m PsbtMap, fields []psbtField, path []string) (interface{}, []string, error) {
+	f, ok := findPsbtFieldName(fields, path[0])
+	if !ok {
+		return nil, nil, fmt.Errorf("no such link")
+	}
+
+	if f.keyed {
+		if len(path) == 1 {
+			out := make(map[string][]byte)
+			for _, k := range m.KeyData(f.keyType) {
+				out[hex.EncodeToString(k)], _ = m.Get(f.keyType, k)
+			}
+			return out, nil, nil
+		}
+
+		keyData, err := hex.DecodeString(path[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		v, ok := m.Get(f.keyType, keyData)
+		if !ok {
+			return nil, nil, fmt.Errorf("no such link")
+		}
+		return v, path[2:], nil
+	}
+
+	v, ok := m.Get(f.keyType, nil)
+	if !ok {
+		return nil, nil, fmt.Errorf("no such link")
+	}
+	if f.decode == nil {
+		return v, path[1:], nil
+	}
+
+	val, err := f.decode(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s, ok := val.(Script); ok {
+		return s.resolve(path[1:])
+	}
+	return val, path[1:], nil
+}
+
+func (p *Psbt) ResolveLink(path []string) (*node.Link, []string, error) {
+	out, rest, err := p.Resolve(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lnk, ok := out.(*node.Link)
+	if !ok {
+		return nil, nil, fmt.Errorf("object at path was not a link")
+	}
+
+	return lnk, rest, nil
+}
+
+func (p *Psbt) Copy() node.Node {
+	np := &Psbt{Global: p.Global.copy()}
+	for _, m := range p.Inputs {
+		np.Inputs = append(np.Inputs, m.copy())
+	}
+	for _, m := range p.Outputs {
+		np.Outputs = append(np.Outputs, m.copy())
+	}
+	return np
+}
+
+func (p *Psbt) Size() (uint64, error) {
+	return uint64(len(p.RawData())), nil
+}
+
+func (p *Psbt) Stat() (*node.NodeStat, error) {
+	return &node.NodeStat{}, nil
+}
+
+func (p *Psbt) String() string {
+	return "[bitcoin psbt]"
+}
+
+// Tree lists the paths of the fields present in the PSBT.
+func (p *Psbt) Tree(path string, depth int) []string {
+	var out []string
+	if _, err := p.UnsignedTx(); err == nil {
+		out = append(out, "tx")
+	}
+	out = append(out, "version", "inputs", "outputs")
+	out = psbtMapTree(out, "", p.Global, psbtGlobalFields)
+	for i, m := range p.Inputs {
+		prefix := fmt.Sprintf("inputs/%d", i)
+		out = append(out, prefix)
+		out = psbtMapTree(out, prefix+"/", m, psbtInputFields)
+	}
+	for i, m := range p.Outputs {
+		prefix := fmt.Sprintf("outputs/%d", i)
+		out = append(out, prefix)
+		out = psbtMapTree(out, prefix+"/", m, psbtOutputFields)
+	}
+	return filterTree(out, path, depth)
+}
+
+func psbtMapTree(out []string, prefix string, m PsbtMap, fields []psbtField) []string {
+	for _, f := range fields {
+		// the version is listed whether or not it is set
+		if f.name == "version" {
+			continue
+		}
+
+		if !f.keyed {
+			v, ok := m.Get(f.keyType, nil)
+			if !ok {
+				continue
+			}
+			if f.decode == nil {
+				out = append(out, prefix+f.name)
+				continue
+			}
+
+			val, err := f.decode(v)
+			if err != nil {
+				continue
+			}
+			if s, ok := val.(Script); ok {
+				out = s.tree(out, prefix+f.name)
+			} else {
+				out = append(out, prefix+f.name)
+			}
+			continue
+		}
+
+		keys := m.KeyData(f.keyType)
+		if len(keys) > 0 {
+			out = append(out, prefix+f.name)
+		}
+		for _, k := range keys {
+			out = append(out, prefix+f.name+"/"+hex.EncodeToString(k))
+		}
+	}
+	return out
+}
+
+var _ node.Node = (*Psbt)(nil)
@@ -0,0 +1,360 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+)
+
+// fixtures/psbt.json holds the test vectors of BIP174, BIP370 and BIP371.
+type psbtFixtures struct {
+	Invalid []struct {
+		Comment string `json:"comment"`
+		Psbt    string `json:"psbt"`
+	} `json:"invalid"`
+	Valid []struct {
+		Comment string `json:"comment"`
+		Psbt    string `json:"psbt"`
+	} `json:"valid"`
+	LockTimes []struct {
+		Comment  string  `json:"comment"`
+		Psbt     string  `json:"psbt"`
+		LockTime *uint32 `json:"lockTime"`
+	} `json:"lockTimes"`
+	Workflow map[string]string `json:"workflow"`
+}
+
+func loadPsbtFixtures(t *testing.T) *psbtFixtures {
+	data, err := os.ReadFile("fixtures/psbt.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f psbtFixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	return &f
+}
+
+func mustDecodePsbt(t *testing.T, s string) *Psbt {
+	p, err := DecodePsbt(mustHex(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPsbtVectors(t *testing.T) {
+	f := loadPsbtFixtures(t)
+
+	for _, test := range f.Invalid {
+		if _, err := DecodePsbt(mustHex(t, test.Psbt)); err == nil {
+			t.Errorf("%s: expected an error", test.Comment)
+		}
+	}
+
+	for _, test := range f.Valid {
+		raw := mustHex(t, test.Psbt)
+		p, err := DecodePsbt(raw)
+		if err != nil {
+			t.Errorf("%s: %s", test.Comment, err)
+			continue
+		}
+
+		// the serialization is canonical, so decoding it again gives the
+		// same PSBT
+		again, err := DecodePsbt(p.RawData())
+		if err != nil {
+			t.Errorf("%s: %s", test.Comment, err)
+			continue
+		}
+		if !bytes.Equal(again.RawData(), p.RawData()) {
+			t.Errorf("%s: serialization does not round trip", test.Comment)
+		}
+
+		b64, err := DecodePsbtBase64(p.Base64())
+		if err != nil || !b64.Cid().Equals(p.Cid()) {
+			t.Errorf("%s: base64 encoding does not round trip", test.Comment)
+		}
+	}
+
+	for _, test := range f.LockTimes {
+		tx, err := mustDecodePsbt(t, test.Psbt).UnsignedTx()
+		if test.LockTime == nil {
+			if !errors.Is(err, ErrInvalidPsbt) {
+				t.Errorf("%s: expected ErrInvalidPsbt, got %v", test.Comment, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.Comment, err)
+			continue
+		}
+		if tx.LockTime != *test.LockTime {
+			t.Errorf("%s: expected lock time %d, got %d", test.Comment, *test.LockTime, tx.LockTime)
+		}
+	}
+}
+
+func TestPsbtWorkflow(t *testing.T) {
+	w := loadPsbtFixtures(t).Workflow
+
+	txid := func(display string) cid.Cid {
+		h := mustHex(t, display)
+		for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+			h[i], h[j] = h[j], h[i]
+		}
+		return hashToCid(h, cid.BitcoinTx)
+	}
+
+	b := NewTxBuilder()
+	b.AddInput(txid("75ddabb27b8845f5247975c8a5ba7c6f336c4570708ebe230caf6db5217ae858"), 0, nil)
+	b.AddInput(txid("1dea7cd05979072a3578cab271c02244ea8a090bbb46aa680a65ecd027048d83"), 1, nil)
+	b.AddOutput(mustHex(t, "0014d85c2b71d0060b09c9886aeb815e50991dda124d"), 149990000)
+	b.AddOutput(mustHex(t, "001400aea9a2e5f0f876a588df5546e8742d1d87008f"), 100000000)
+	tx, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPsbt(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(p.RawData()); got != w["creator"] {
+		t.Fatalf("creator: expected %s, got %s", w["creator"], got)
+	}
+
+	// the signers of BIP174 signed in turn, but the test only needs their
+	// results to be combined
+	p = mustDecodePsbt(t, w["signedA"])
+	if err := p.Combine(mustDecodePsbt(t, w["signedB"])); err != nil {
+		t.Fatal(err)
+	}
+	// Bitcoin Core orders partial signatures by the hash of their key, so
+	// only the fields are compared
+	if !reflect.DeepEqual(p, mustDecodePsbt(t, w["combined"])) {
+		t.Fatalf("combiner: expected %s, got %x", w["combined"], p.RawData())
+	}
+
+	if _, err := p.Extract(); !errors.Is(err, ErrInvalidPsbt) {
+		t.Fatalf("expected extracting before finalizing to fail, got %v", err)
+	}
+
+	if err := p.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(p.RawData()); got != w["finalized"] {
+		t.Fatalf("finalizer: expected %s, got %s", w["finalized"], got)
+	}
+
+	final, err := p.Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(final.RawData()); got != w["extracted"] {
+		t.Fatalf("extractor: expected %s, got %s", w["extracted"], got)
+	}
+
+	unknown := mustDecodePsbt(t, w["unknownA"])
+	if err := unknown.Combine(mustDecodePsbt(t, w["unknownB"])); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(unknown.RawData()); got != w["unknownCombined"] {
+		t.Fatalf("combiner: expected %s, got %s", w["unknownCombined"], got)
+	}
+
+	if err := p.Combine(unknown); !errors.Is(err, ErrInvalidPsbt) {
+		t.Fatalf("expected combining different transactions to fail, got %v", err)
+	}
+}
+
+func TestPsbtFinalize(t *testing.T) {
+	f := loadPsbtFixtures(t)
+
+	// one signature of each 2 of 2 multisig input is missing
+	p := mustDecodePsbt(t, f.Workflow["signedA"])
+	if err := p.Finalize(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := hex.EncodeToString(p.RawData()); got != f.Workflow["signedA"] {
+		t.Fatal("incomplete inputs were changed")
+	}
+
+	// the signed taproot inputs of BIP371 spend through the key path and a
+	// script path
+	var n int
+	for _, test := range f.Valid {
+		if !strings.Contains(test.Comment, "P2TR") || !strings.Contains(test.Comment, "signature") {
+			continue
+		}
+
+		p := mustDecodePsbt(t, test.Psbt)
+		if err := p.Finalize(); err != nil {
+			t.Fatalf("%s: %s", test.Comment, err)
+		}
+		tx, err := p.Extract()
+		if err != nil {
+			t.Fatalf("%s: %s", test.Comment, err)
+		}
+		if !tx.HasWitness() || len(tx.Inputs[0].Script) != 0 {
+			t.Fatalf("%s: expected a witness spend", test.Comment)
+		}
+		if _, ok := p.Inputs[0].Get(PsbtInTapInternalKey, nil); ok {
+			t.Fatalf("%s: signing fields were kept", test.Comment)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 signed taproot vectors, found %d", n)
+	}
+}
+
+func TestPsbtEmptyPartialSig(t *testing.T) {
+	key := mustHex(t, "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+
+	b := NewTxBuilder()
+	b.AddInput(hashToCid(make([]byte, 32), cid.BitcoinTx), 0, nil)
+	b.AddOutput(append(append([]byte{0x76, 0xa9, 0x14}, hash160(key)...), 0x88, 0xac), 50000)
+	prev, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b = NewTxBuilder()
+	b.AddInput(prev.Cid(), 0, nil)
+	b.AddOutput(mustHex(t, "0014d85c2b71d0060b09c9886aeb815e50991dda124d"), 40000)
+	tx, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPsbt(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Inputs[0].Set(PsbtInNonWitnessUtxo, nil, prev.RawData())
+	p.Inputs[0].Set(PsbtInSigHashType, nil, []byte{1, 0, 0, 0})
+	p.Inputs[0].Set(PsbtInPartialSig, key, nil)
+
+	if _, err := DecodePsbt(p.RawData()); !errors.Is(err, ErrInvalidPsbt) {
+		t.Fatalf("expected an empty partial signature to be rejected, got %v", err)
+	}
+	if err := p.Finalize(); err == nil {
+		t.Fatal("expected finalizing with an empty partial signature to fail")
+	}
+}
+
+func TestPsbtV2BadCount(t *testing.T) {
+	// version 2 globals: version, tx version, input count and output count
+	for _, count := range []string{
+		"0104" + "00",     // empty input count
+		"0104" + "02fd01", // truncated input count
+	} {
+		raw := mustHex(t, "70736274ff"+"01fb0402000000"+"01020402000000"+count+"0105"+"0100"+"00")
+		if _, err := DecodePsbt(raw); !errors.Is(err, ErrInvalidPsbt) {
+			t.Fatalf("%x: expected ErrInvalidPsbt, got %v", raw, err)
+		}
+	}
+}
+
+func TestPsbtResolve(t *testing.T) {
+	w := loadPsbtFixtures(t).Workflow
+	p := mustDecodePsbt(t, w["combined"])
+
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lnk, rest, err := p.ResolveLink([]string{"tx", "inputs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lnk.Cid.Equals(tx.Cid()) || len(rest) != 1 {
+		t.Fatalf("unexpected link %s, rest %v", lnk.Cid, rest)
+	}
+
+	links := p.Links()
+	if len(links) != 2 || links[0].Name != "tx" || links[1].Name != "inputs/0/nonWitnessUtxo" {
+		t.Fatalf("unexpected links %v", links)
+	}
+	if !links[1].Cid.Equals(tx.Inputs[0].PrevTx) {
+		t.Fatal("non-witness utxo does not link to the spent transaction")
+	}
+
+	out, _, err := p.Resolve([]string{"inputs", "1", "witnessUtxo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utxo, ok := out.(*TxOut); !ok || utxo.Value != 200000000 {
+		t.Fatalf("unexpected witness utxo %v", out)
+	}
+
+	out, _, err = p.Resolve([]string{"inputs", "0", "sighashType"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != uint32(SigHashAll) {
+		t.Fatalf("unexpected sighash type %v", out)
+	}
+
+	out, _, err = p.Resolve([]string{"inputs", "0", "redeemScript", "asm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.(string); !ok {
+		t.Fatalf("unexpected redeem script %v", out)
+	}
+
+	out, _, err = p.Resolve([]string{"inputs", "0", "partialSigs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs := out.(map[string][]byte)
+	if len(sigs) != 2 {
+		t.Fatalf("expected 2 partial signatures, got %d", len(sigs))
+	}
+	for key, sig := range sigs {
+		out, _, err := p.Resolve([]string{"inputs", "0", "partialSigs", key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.([]byte), sig) {
+			t.Fatal("partial signature mismatch")
+		}
+	}
+
+	if _, _, err := p.Resolve([]string{"inputs", "2"}); err == nil {
+		t.Fatal("expected an error for an input out of range")
+	}
+	if _, _, err := p.Resolve([]string{"outputs", "0", "amount"}); err == nil {
+		t.Fatal("expected an error for a field only found in version 2")
+	}
+
+	for _, path := range p.Tree("", -1) {
+		if _, _, err := p.Resolve(strings.Split(path, "/")); err != nil {
+			t.Errorf("%s: %s", path, err)
+		}
+	}
+	for _, path := range p.Tree("inputs/1", 1) {
+		if path != "witnessUtxo" && path != "witnessScript" && path != "redeemScript" &&
+			path != "partialSigs" && path != "bip32Derivation" && path != "sighashType" {
+			t.Errorf("unexpected path %s", path)
+		}
+	}
+
+	var _ node.Node = p.Copy()
+	if !p.Copy().Cid().Equals(p.Cid()) {
+		t.Fatal("copy differs")
+	}
+}
@@ -0,0 +1,432 @@
+package ipldbtc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Opcode is a bitcoin script opcode.
+type Opcode byte
+
+// Opcodes, named after their OP_ names in Bitcoin Core. Opcodes 0x01 to
+// 0x4b push that many bytes of data.
+const (
+	OpFalse               Opcode = 0x00
+	OpPushData1           Opcode = 0x4c
+	OpPushData2           Opcode = 0x4d
+	OpPushData4           Opcode = 0x4e
+	Op1Negate             Opcode = 0x4f
+	OpReserved            Opcode = 0x50
+	OpTrue                Opcode = 0x51
+	Op2                   Opcode = 0x52
+	Op3                   Opcode = 0x53
+	Op4                   Opcode = 0x54
+	Op5                   Opcode = 0x55
+	Op6                   Opcode = 0x56
+	Op7                   Opcode = 0x57
+	Op8                   Opcode = 0x58
+	Op9                   Opcode = 0x59
+	Op10                  Opcode = 0x5a
+	Op11                  Opcode = 0x5b
+	Op12                  Opcode = 0x5c
+	Op13                  Opcode = 0x5d
+	Op14                  Opcode = 0x5e
+	Op15                  Opcode = 0x5f
+	Op16                  Opcode = 0x60
+	OpNop                 Opcode = 0x61
+	OpVer                 Opcode = 0x62
+	OpIf                  Opcode = 0x63
+	OpNotIf               Opcode = 0x64
+	OpVerIf               Opcode = 0x65
+	OpVerNotIf            Opcode = 0x66
+	OpElse                Opcode = 0x67
+	OpEndIf               Opcode = 0x68
+	OpVerify              Opcode = 0x69
+	OpReturn              Opcode = 0x6a
+	OpToAltStack          Opcode = 0x6b
+	OpFromAltStack        Opcode = 0x6c
+	Op2Drop               Opcode = 0x6d
+	Op2Dup                Opcode = 0x6e
+	Op3Dup                Opcode = 0x6f
+	Op2Over               Opcode = 0x70
+	Op2Rot                Opcode = 0x71
+	Op2Swap               Opcode = 0x72
+	OpIfDup               Opcode = 0x73
+	OpDepth               Opcode = 0x74
+	OpDrop                Opcode = 0x75
+	OpDup                 Opcode = 0x76
+	OpNip                 Opcode = 0x77
+	OpOver                Opcode = 0x78
+	OpPick                Opcode = 0x79
+	OpRoll                Opcode = 0x7a
+	OpRot                 Opcode = 0x7b
+	OpSwap                Opcode = 0x7c
+	OpTuck                Opcode = 0x7d
+	OpCat                 Opcode = 0x7e
+	OpSubStr              Opcode = 0x7f
+	OpLeft                Opcode = 0x80
+	OpRight               Opcode = 0x81
+	OpSize                Opcode = 0x82
+	OpInvert              Opcode = 0x83
+	OpAnd                 Opcode = 0x84
+	OpOr                  Opcode = 0x85
+	OpXor                 Opcode = 0x86
+	OpEqual               Opcode = 0x87
+	OpEqualVerify         Opcode = 0x88
+	OpReserved1           Opcode = 0x89
+	OpReserved2           Opcode = 0x8a
+	Op1Add                Opcode = 0x8b
+	Op1Sub                Opcode = 0x8c
+	Op2Mul                Opcode = 0x8d
+	Op2Div                Opcode = 0x8e
+	OpNegate              Opcode = 0x8f
+	OpAbs                 Opcode = 0x90
+	OpNot                 Opcode = 0x91
+	Op0NotEqual           Opcode = 0x92
+	OpAdd                 Opcode = 0x93
+	OpSub                 Opcode = 0x94
+	OpMul                 Opcode = 0x95
+	OpDiv                 Opcode = 0x96
+	OpMod                 Opcode = 0x97
+	OpLShift              Opcode = 0x98
+	OpRShift              Opcode = 0x99
+	OpBoolAnd             Opcode = 0x9a
+	OpBoolOr              Opcode = 0x9b
+	OpNumEqual            Opcode = 0x9c
+	OpNumEqualVerify      Opcode = 0x9d
+	OpNumNotEqual         Opcode = 0x9e
+	OpLessThan            Opcode = 0x9f
+	OpGreaterThan         Opcode = 0xa0
+	OpLessThanOrEqual     Opcode = 0xa1
+	OpGreaterThanOrEqual  Opcode = 0xa2
+	OpMin                 Opcode = 0xa3
+	OpMax                 Opcode = 0xa4
+	OpWithin              Opcode = 0xa5
+	OpRipemd160           Opcode = 0xa6
+	OpSha1                Opcode = 0xa7
+	OpSha256              Opcode = 0xa8
+	OpHash160             Opcode = 0xa9
+	OpHash256             Opcode = 0xaa
+	OpCodeSeparator       Opcode = 0xab
+	OpCheckSig            Opcode = 0xac
+	OpCheckSigVerify      Opcode = 0xad
+	OpCheckMultiSig       Opcode = 0xae
+	OpCheckMultiSigVerify Opcode = 0xaf
+	OpNop1                Opcode = 0xb0
+	OpCheckLockTimeVerify Opcode = 0xb1
+	OpCheckSequenceVerify Opcode = 0xb2
+	OpNop4                Opcode = 0xb3
+	OpNop5                Opcode = 0xb4
+	OpNop6                Opcode = 0xb5
+	OpNop7                Opcode = 0xb6
+	OpNop8                Opcode = 0xb7
+	OpNop9                Opcode = 0xb8
+	OpNop10               Opcode = 0xb9
+	OpCheckSigAdd         Opcode = 0xba
+	OpInvalidOpcode       Opcode = 0xff
+)
+
+// Alternative names for some opcodes. OpNop2 and OpNop3 are the names the
+// opcodes had before BIP65 and BIP112.
+const (
+	Op0    = OpFalse
+	Op1    = OpTrue
+	OpNop2 = OpCheckLockTimeVerify
+	OpNop3 = OpCheckSequenceVerify
+)
+
+var opcodeNames = map[Opcode]string{
+	OpFalse:               "0",
+	OpPushData1:           "OP_PUSHDATA1",
+	OpPushData2:           "OP_PUSHDATA2",
+	OpPushData4:           "OP_PUSHDATA4",
+	Op1Negate:             "-1",
+	OpReserved:            "OP_RESERVED",
+	OpTrue:                "1",
+	Op2:                   "2",
+	Op3:                   "3",
+	Op4:                   "4",
+	Op5:                   "5",
+	Op6:                   "6",
+	Op7:                   "7",
+	Op8:                   "8",
+	Op9:                   "9",
+	Op10:                  "10",
+	Op11:                  "11",
+	Op12:                  "12",
+	Op13:                  "13",
+	Op14:                  "14",
+	Op15:                  "15",
+	Op16:                  "16",
+	OpNop:                 "OP_NOP",
+	OpVer:                 "OP_VER",
+	OpIf:                  "OP_IF",
+	OpNotIf:               "OP_NOTIF",
+	OpVerIf:               "OP_VERIF",
+	OpVerNotIf:            "OP_VERNOTIF",
+	OpElse:                "OP_ELSE",
+	OpEndIf:               "OP_ENDIF",
+	OpVerify:              "OP_VERIFY",
+	OpReturn:              "OP_RETURN",
+	OpToAltStack:          "OP_TOALTSTACK",
+	OpFromAltStack:        "OP_FROMALTSTACK",
+	Op2Drop:               "OP_2DROP",
+	Op2Dup:                "OP_2DUP",
+	Op3Dup:                "OP_3DUP",
+	Op2Over:               "OP_2OVER",
+	Op2Rot:                "OP_2ROT",
+	Op2Swap:               "OP_2SWAP",
+	OpIfDup:               "OP_IFDUP",
+	OpDepth:               "OP_DEPTH",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpNip:                 "OP_NIP",
+	OpOver:                "OP_OVER",
+	OpPick:                "OP_PICK",
+	OpRoll:                "OP_ROLL",
+	OpRot:                 "OP_ROT",
+	OpSwap:                "OP_SWAP",
+	OpTuck:                "OP_TUCK",
+	OpCat:                 "OP_CAT",
+	OpSubStr:              "OP_SUBSTR",
+	OpLeft:                "OP_LEFT",
+	OpRight:               "OP_RIGHT",
+	OpSize:                "OP_SIZE",
+	OpInvert:              "OP_INVERT",
+	OpAnd:                 "OP_AND",
+	OpOr:                  "OP_OR",
+	OpXor:                 "OP_XOR",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	OpReserved1:           "OP_RESERVED1",
+	OpReserved2:           "OP_RESERVED2",
+	Op1Add:                "OP_1ADD",
+	Op1Sub:                "OP_1SUB",
+	Op2Mul:                "OP_2MUL",
+	Op2Div:                "OP_2DIV",
+	OpNegate:              "OP_NEGATE",
+	OpAbs:                 "OP_ABS",
+	OpNot:                 "OP_NOT",
+	Op0NotEqual:           "OP_0NOTEQUAL",
+	OpAdd:                 "OP_ADD",
+	OpSub:                 "OP_SUB",
+	OpMul:                 "OP_MUL",
+	OpDiv:                 "OP_DIV",
+	OpMod:                 "OP_MOD",
+	OpLShift:              "OP_LSHIFT",
+	OpRShift:              "OP_RSHIFT",
+	OpBoolAnd:             "OP_BOOLAND",
+	OpBoolOr:              "OP_BOOLOR",
+	OpNumEqual:            "OP_NUMEQUAL",
+	OpNumEqualVerify:      "OP_NUMEQUALVERIFY",
+	OpNumNotEqual:         "OP_NUMNOTEQUAL",
+	OpLessThan:            "OP_LESSTHAN",
+	OpGreaterThan:         "OP_GREATERTHAN",
+	OpLessThanOrEqual:     "OP_LESSTHANOREQUAL",
+	OpGreaterThanOrEqual:  "OP_GREATERTHANOREQUAL",
+	OpMin:                 "OP_MIN",
+	OpMax:                 "OP_MAX",
+	OpWithin:              "OP_WITHIN",
+	OpRipemd160:           "OP_RIPEMD160",
+	OpSha1:                "OP_SHA1",
+	OpSha256:              "OP_SHA256",
+	OpHash160:             "OP_HASH160",
+	OpHash256:             "OP_HASH256",
+	OpCodeSeparator:       "OP_CODESEPARATOR",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultiSig:       "OP_CHECKMULTISIG",
+	OpCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	OpNop1:                "OP_NOP1",
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+	OpCheckSequenceVerify: "OP_CHECKSEQUENCEVERIFY",
+	OpNop4:                "OP_NOP4",
+	OpNop5:                "OP_NOP5",
+	OpNop6:                "OP_NOP6",
+	OpNop7:                "OP_NOP7",
+	OpNop8:                "OP_NOP8",
+	OpNop9:                "OP_NOP9",
+	OpNop10:               "OP_NOP10",
+	OpCheckSigAdd:         "OP_CHECKSIGADD",
+	OpInvalidOpcode:       "OP_INVALIDOPCODE",
+}
+
+// String returns the name of the opcode as used by Bitcoin Core, such as
+// "OP_DUP", "0" or "16", and "OP_UNKNOWN" for undefined opcodes.
+func (o Opcode) String() string {
+	if name, ok := opcodeNames[o]; ok {
+		return name
+	}
+	return "OP_UNKNOWN"
+}
+
+// Script is a bitcoin script, as held by TxIn.Script and TxOut.Script.
+type Script []byte
+
+// Op is a single operation of a script. For opcodes that push data, Data
+// holds the bytes pushed.
+type Op struct {
+	Opcode Opcode `json:"opcode"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// IsPush reports whether the op pushes data, including the empty push of
+// OpFalse, rather than one of the small integer opcodes.
+func (op Op) IsPush() bool {
+	return op.Opcode <= OpPushData4
+}
+
+// String returns the op as it appears in the asm form of a script: the
+// opcode name, or for pushes the data in hex, or as a decimal number if no
+// longer than 4 bytes.
+func (op Op) String() string {
+	if !op.IsPush() {
+		return op.Opcode.String()
+	}
+
+	if len(op.Data) <= 4 {
+		return strconv.FormatInt(scriptNum(op.Data), 10)
+	}
+	return hex.EncodeToString(op.Data)
+}
+
+// Ops tokenizes the script. If the script ends in a push that runs past its
+// end, the ops before it are returned along with ErrMalformedPush.
+func (s Script) Ops() ([]Op, error) {
+	var ops []Op
+	for pc := 0; pc < len(s); {
+		op, n, err := s.opAt(pc)
+		if err != nil {
+			return ops, err
+		}
+		ops = append(ops, op)
+		pc += n
+	}
+	return ops, nil
+}
+
+// opAt reads the op at position pc and returns it with its size.
+func (s Script) opAt(pc int) (Op, int, error) {
+	op := Op{Opcode: Opcode(s[pc])}
+	if op.Opcode > OpPushData4 {
+		return op, 1, nil
+	}
+
+	size, header := int(op.Opcode), 1
+	switch op.Opcode {
+	case OpPushData1:
+		header = 2
+		if len(s) < pc+header {
+			return op, 0, fmt.Errorf("%w at %d: missing OP_PUSHDATA1 length", ErrMalformedPush, pc)
+		}
+		size = int(s[pc+1])
+	case OpPushData2:
+		header = 3
+		if len(s) < pc+header {
+			return op, 0, fmt.Errorf("%w at %d: missing OP_PUSHDATA2 length", ErrMalformedPush, pc)
+		}
+		size = int(binary.LittleEndian.Uint16(s[pc+1:]))
+	case OpPushData4:
+		header = 5
+		if len(s) < pc+header {
+			return op, 0, fmt.Errorf("%w at %d: missing OP_PUSHDATA4 length", ErrMalformedPush, pc)
+		}
+		size = int(binary.LittleEndian.Uint32(s[pc+1:]))
+	}
+
+	if size > len(s)-pc-header {
+		return op, 0, fmt.Errorf("%w at %d: push of %d bytes past end of script", ErrMalformedPush, pc, size)
+	}
+
+	op.Data = s[pc+header : pc+header+size]
+	return op, header + size, nil
+}
+
+// Asm returns the script in the asm form used by Bitcoin Core, with ops
+// separated by spaces. A malformed push at the end is shown as "[error]".
+func (s Script) Asm() string {
+	ops, err := s.Ops()
+
+	parts := make([]string, 0, len(ops)+1)
+	for _, op := range ops {
+		parts = append(parts, op.String())
+	}
+	if err != nil {
+		parts = append(parts, "[error]")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// resolve resolves path within the script: "asm" for its asm form, "ops"
+// for its ops and "ops/N" for a single op.
+func (s Script) resolve(path []string) (interface{}, []string, error) {
+	if len(path) == 0 {
+		return []byte(s), nil, nil
+	}
+
+	switch path[0] {
+	case "asm":
+		return s.Asm(), path[1:], nil
+	case "ops":
+		ops, err := s.Ops()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(path) == 1 {
+			return ops, nil, nil
+		}
+
+		index, err := strconv.Atoi(path[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if index >= len(ops) || index < 0 {
+			return nil, nil, fmt.Errorf("index out of range")
+		}
+
+		return ops[index], path[2:], nil
+	default:
+		return nil, nil, fmt.Errorf("no such link")
+	}
+}
+
+// tree appends to out the paths resolved by resolve below prefix, the path
+// of the script itself.
+func (s Script) tree(out []string, prefix string) []string {
+	out = append(out, prefix, prefix+"/asm")
+	ops, err := s.Ops()
+	if err != nil {
+		return out
+	}
+
+	out = append(out, prefix+"/ops")
+	for i := range ops {
+		out = append(out, fmt.Sprintf("%s/ops/%d", prefix, i))
+	}
+	return out
+}
+
+// scriptNum decodes a little endian sign and magnitude number as used by
+// script, for data of up to 8 bytes.
+func scriptNum(data []byte) int64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var res int64
+	for i, b := range data {
+		res |= int64(b) << uint(8*i)
+	}
+
+	last := data[len(data)-1]
+	if last&0x80 != 0 {
+		return -(res &^ (int64(0x80) << uint(8*(len(data)-1))))
+	}
+	return res
+}
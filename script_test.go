@@ -0,0 +1,95 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestScriptAsm(t *testing.T) {
+	for _, c := range []struct {
+		script string
+		asm    string
+	}{
+		{"76a914c825a1ecf2a6830c4401620c3a16f1995057c2ab88ac", "OP_DUP OP_HASH160 c825a1ecf2a6830c4401620c3a16f1995057c2ab OP_EQUALVERIFY OP_CHECKSIG"},
+		{"0014751e76e8199196d454941c45d1b3a323f1433bd6", "0 751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"03a6ab05", "371622"},
+		{"4f5160", "-1 1 16"},
+		{"0181", "-1"},
+		{"028000", "128"},
+		{"0480808080", "-8421504"},
+		{"4c0107", "7"},
+		{"4d05000102030405", "0102030405"},
+		{"4e050000000102030405", "0102030405"},
+		{"b1b2babbff", "OP_CHECKLOCKTIMEVERIFY OP_CHECKSEQUENCEVERIFY OP_CHECKSIGADD OP_UNKNOWN OP_INVALIDOPCODE"},
+		{"6a", "OP_RETURN"},
+		{"", ""},
+		{"01", "[error]"},
+		{"4c", "[error]"},
+		{"4d01", "[error]"},
+		{"76a94c05ab", "OP_DUP OP_HASH160 [error]"},
+	} {
+		script, err := hex.DecodeString(c.script)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if asm := Script(script).Asm(); asm != c.asm {
+			t.Fatalf("%s: expected %q, got %q", c.script, c.asm, asm)
+		}
+	}
+}
+
+func TestScriptOps(t *testing.T) {
+	script, _ := hex.DecodeString("76a94c05ab")
+	ops, err := Script(script).Ops()
+	if !errors.Is(err, ErrMalformedPush) {
+		t.Fatalf("expected ErrMalformedPush, got %v", err)
+	}
+	if len(ops) != 2 || ops[0].Opcode != OpDup || ops[1].Opcode != OpHash160 {
+		t.Fatalf("expected the ops before the malformed push, got %v", ops)
+	}
+
+	data, err := hex.DecodeString(txdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := DecodeTx(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, rest, err := tx.Resolve([]string{"outputs", "0", "script", "ops", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, ok := out.(Op)
+	if !ok || len(rest) != 0 {
+		t.Fatalf("expected an op, got %T", out)
+	}
+	if !op.IsPush() || hex.EncodeToString(op.Data) != "c825a1ecf2a6830c4401620c3a16f1995057c2ab" {
+		t.Fatalf("unexpected op %v", op)
+	}
+
+	out, _, err = tx.Resolve([]string{"outputs", "0", "script", "asm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "OP_DUP OP_HASH160 c825a1ecf2a6830c4401620c3a16f1995057c2ab OP_EQUALVERIFY OP_CHECKSIG" {
+		t.Fatalf("unexpected asm %v", out)
+	}
+
+	out, _, err = tx.Resolve([]string{"inputs", "0", "script"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.([]byte), tx.Inputs[0].Script) {
+		t.Fatal("expected the raw input script")
+	}
+
+	if _, _, err := tx.Resolve([]string{"outputs", "0", "script", "ops", "5"}); err == nil {
+		t.Fatal("expected error resolving op out of range")
+	}
+}
@@ -0,0 +1,199 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	mh "github.com/multiformats/go-multihash"
+)
+
+// SigHashType selects which parts of a transaction a signature commits to.
+type SigHashType uint32
+
+const (
+	// SigHashDefault is the taproot hash type of 64 byte signatures, which
+	// commit to the whole transaction like SigHashAll.
+	SigHashDefault SigHashType = 0x00
+
+	SigHashAll          SigHashType = 0x01
+	SigHashNone         SigHashType = 0x02
+	SigHashSingle       SigHashType = 0x03
+	SigHashAnyoneCanPay SigHashType = 0x80
+
+	// sigHashMask selects the base type, ignoring ANYONECANPAY
+	sigHashMask = 0x1f
+)
+
+func (h SigHashType) base() SigHashType {
+	return h & sigHashMask
+}
+
+func (h SigHashType) anyoneCanPay() bool {
+	return h&SigHashAnyoneCanPay != 0
+}
+
+// SigHashLegacy returns the hash signed by a pre-segwit signature of input
+// i, where scriptCode is the script being executed: the output script spent,
+// or the redeem script for P2SH. OP_CODESEPARATORs are removed from
+// scriptCode; removing the signature itself is left to the caller, as it is
+// part of script execution.
+//
+// As in Bitcoin Core, SIGHASH_SINGLE without a matching output gives the
+// hash 1 rather than an error.
+func (t *Tx) SigHashLegacy(i int, scriptCode []byte, hashType SigHashType) ([]byte, error) {
+	if i < 0 || i >= len(t.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", i)
+	}
+
+	if hashType.base() == SigHashSingle && i >= len(t.Outputs) {
+		one := make([]byte, 32)
+		one[0] = 1
+		return one, nil
+	}
+
+	buf := new(bytes.Buffer)
+	writeUint32(buf, t.Version)
+
+	inputs := t.Inputs
+	if hashType.anyoneCanPay() {
+		inputs = t.Inputs[i : i+1]
+	}
+
+	writeVarInt(buf, uint64(len(inputs)))
+	for j, inp := range inputs {
+		in := TxIn{PrevTx: inp.PrevTx, PrevTxIndex: inp.PrevTxIndex, SeqNo: inp.SeqNo}
+		if hashType.anyoneCanPay() || j == i {
+			in.Script = removeCodeSeparators(scriptCode)
+		} else if hashType.base() == SigHashNone || hashType.base() == SigHashSingle {
+			in.SeqNo = 0
+		}
+		if _, err := in.WriteTo(buf); err != nil {
+			return nil, fmt.Errorf("input %d: %w", j, err)
+		}
+	}
+
+	var outputs []*TxOut
+	switch hashType.base() {
+	case SigHashNone:
+	case SigHashSingle:
+		outputs = make([]*TxOut, i+1)
+		for j := 0; j < i; j++ {
+			outputs[j] = &TxOut{Value: ^uint64(0)}
+		}
+		outputs[i] = t.Outputs[i]
+	default:
+		outputs = t.Outputs
+	}
+
+	writeVarInt(buf, uint64(len(outputs)))
+	for _, out := range outputs {
+		out.WriteTo(buf)
+	}
+
+	writeUint32(buf, t.LockTime)
+	writeUint32(buf, uint32(hashType))
+
+	return dsha256(buf.Bytes()), nil
+}
+
+// SigHashBIP143 returns the hash signed by a segwit v0 signature of input i
+// spending amount satoshis, as defined by BIP143. scriptCode is the script
+// being executed without its length prefix: the witness script for P2WSH,
+// or the P2PKH script of the key hash for P2WPKH.
+func (t *Tx) SigHashBIP143(i int, scriptCode []byte, amount uint64, hashType SigHashType) ([]byte, error) {
+	if i < 0 || i >= len(t.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", i)
+	}
+
+	zero := make([]byte, 32)
+	hashPrevouts, hashSequence, hashOutputs := zero, zero, zero
+
+	if !hashType.anyoneCanPay() {
+		buf := new(bytes.Buffer)
+		for _, inp := range t.Inputs {
+			writeOutpoint(buf, inp)
+		}
+		hashPrevouts = dsha256(buf.Bytes())
+	}
+
+	base := hashType.base()
+	if !hashType.anyoneCanPay() && base != SigHashSingle && base != SigHashNone {
+		buf := new(bytes.Buffer)
+		for _, inp := range t.Inputs {
+			writeUint32(buf, inp.SeqNo)
+		}
+		hashSequence = dsha256(buf.Bytes())
+	}
+
+	if base != SigHashSingle && base != SigHashNone {
+		buf := new(bytes.Buffer)
+		for _, out := range t.Outputs {
+			out.WriteTo(buf)
+		}
+		hashOutputs = dsha256(buf.Bytes())
+	} else if base == SigHashSingle && i < len(t.Outputs) {
+		buf := new(bytes.Buffer)
+		t.Outputs[i].WriteTo(buf)
+		hashOutputs = dsha256(buf.Bytes())
+	}
+
+	inp := t.Inputs[i]
+	buf := new(bytes.Buffer)
+	writeUint32(buf, t.Version)
+	buf.Write(hashPrevouts)
+	buf.Write(hashSequence)
+	writeOutpoint(buf, inp)
+	writeVarInt(buf, uint64(len(scriptCode)))
+	buf.Write(scriptCode)
+	writeUint64(buf, amount)
+	writeUint32(buf, inp.SeqNo)
+	buf.Write(hashOutputs)
+	writeUint32(buf, t.LockTime)
+	writeUint32(buf, uint32(hashType))
+
+	return dsha256(buf.Bytes()), nil
+}
+
+// removeCodeSeparators returns script without its OP_CODESEPARATOR ops. A
+// malformed push at the end is kept as is.
+func removeCodeSeparators(script []byte) []byte {
+	s := Script(script)
+	out := make([]byte, 0, len(s))
+	pc := 0
+	for pc < len(s) {
+		_, n, err := s.opAt(pc)
+		if err != nil {
+			break
+		}
+		if Opcode(s[pc]) != OpCodeSeparator {
+			out = append(out, s[pc:pc+n]...)
+		}
+		pc += n
+	}
+
+	return append(out, s[pc:]...)
+}
+
+func writeOutpoint(w io.Writer, inp *TxIn) {
+	w.Write(cidToHash(inp.PrevTx))
+	writeUint32(w, inp.PrevTxIndex)
+}
+
+func writeUint32(w io.Writer, v uint32) {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	w.Write(buf)
+}
+
+func writeUint64(w io.Writer, v uint64) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	w.Write(buf)
+}
+
+func dsha256(data []byte) []byte {
+	sum, _ := mh.Sum(data, mh.DBL_SHA2_256, -1)
+	return sum[2:]
+}
@@ -0,0 +1,237 @@
+package ipldbtc
+
+import (
+	cid "github.com/ipfs/go-cid"
+)
+
+// ScriptClass is the kind of a standard output script.
+type ScriptClass int
+
+const (
+	NonStandard ScriptClass = iota
+	P2PK
+	P2PKH
+	P2SH
+	MultiSig
+	NullData
+	P2WPKH
+	P2WSH
+	P2TR
+	WitnessUnknown
+)
+
+// String returns the name Bitcoin Core uses for the class, such as
+// "pubkeyhash" or "witness_v0_keyhash".
+func (c ScriptClass) String() string {
+	switch c {
+	case P2PK:
+		return "pubkey"
+	case P2PKH:
+		return "pubkeyhash"
+	case P2SH:
+		return "scripthash"
+	case MultiSig:
+		return "multisig"
+	case NullData:
+		return "nulldata"
+	case P2WPKH:
+		return "witness_v0_keyhash"
+	case P2WSH:
+		return "witness_v0_scripthash"
+	case P2TR:
+		return "witness_v1_taproot"
+	case WitnessUnknown:
+		return "witness_unknown"
+	default:
+		return "nonstandard"
+	}
+}
+
+// Class classifies the script as one of the standard output script kinds,
+// following the rules of Bitcoin Core.
+func (s Script) Class() ScriptClass {
+	if s.isScriptHash() {
+		return P2SH
+	}
+
+	if version, program, ok := s.WitnessProgram(); ok {
+		switch {
+		case version == 0 && len(program) == 20:
+			return P2WPKH
+		case version == 0 && len(program) == 32:
+			return P2WSH
+		case version == 1 && len(program) == 32:
+			return P2TR
+		case version != 0:
+			return WitnessUnknown
+		default:
+			return NonStandard
+		}
+	}
+
+	if len(s) >= 1 && s[0] == byte(OpReturn) && s[1:].isPushOnly() {
+		return NullData
+	}
+
+	if s.isPubKey() {
+		return P2PK
+	}
+
+	if s.isPubKeyHash() {
+		return P2PKH
+	}
+
+	if s.isMultiSig() {
+		return MultiSig
+	}
+
+	return NonStandard
+}
+
+// DataCid returns the CID anchored by an OP_RETURN output script: the first
+// data push that holds a CID, either in binary form, optionally prefixed by
+// a zero byte, or as a multibase or base58 string.
+func (s Script) DataCid() (cid.Cid, bool) {
+	if s.Class() != NullData {
+		return cid.Undef, false
+	}
+
+	ops, _ := s[1:].Ops()
+	for _, op := range ops {
+		if len(op.Data) == 0 {
+			continue
+		}
+
+		if c, err := cid.Cast(op.Data); err == nil {
+			return c, true
+		}
+		if op.Data[0] == 0 {
+			if c, err := cid.Cast(op.Data[1:]); err == nil {
+				return c, true
+			}
+		}
+		if c, err := cid.Decode(string(op.Data)); err == nil {
+			return c, true
+		}
+	}
+
+	return cid.Undef, false
+}
+
+// WitnessProgram returns the version and program of a segwit output script.
+func (s Script) WitnessProgram() (int, []byte, bool) {
+	if len(s) < 4 || len(s) > 42 {
+		return 0, nil, false
+	}
+
+	if s[0] != byte(OpFalse) && (s[0] < byte(OpTrue) || s[0] > byte(Op16)) {
+		return 0, nil, false
+	}
+
+	if int(s[1])+2 != len(s) {
+		return 0, nil, false
+	}
+
+	return smallInt(Opcode(s[0])), []byte(s[2:]), true
+}
+
+func (s Script) isScriptHash() bool {
+	return len(s) == 23 &&
+		s[0] == byte(OpHash160) &&
+		s[1] == 20 &&
+		s[22] == byte(OpEqual)
+}
+
+func (s Script) isPubKeyHash() bool {
+	return len(s) == 25 &&
+		s[0] == byte(OpDup) &&
+		s[1] == byte(OpHash160) &&
+		s[2] == 20 &&
+		s[23] == byte(OpEqualVerify) &&
+		s[24] == byte(OpCheckSig)
+}
+
+// isPubKey matches a pay to pubkey script. As in Bitcoin Core, the key must
+// be pushed by the 33 or 65 byte direct push opcode, not OP_PUSHDATA1.
+func (s Script) isPubKey() bool {
+	ops, err := s.Ops()
+	return err == nil &&
+		len(ops) == 2 &&
+		isPubKeyPush(ops[0]) &&
+		ops[0].Opcode == Opcode(len(ops[0].Data)) &&
+		ops[1].Opcode == OpCheckSig
+}
+
+// isMultiSig matches a bare m of n multisig script with n of at most 16.
+func (s Script) isMultiSig() bool {
+	ops, err := s.Ops()
+	if err != nil || len(ops) < 4 {
+		return false
+	}
+
+	last := len(ops) - 1
+	if ops[last].Opcode != OpCheckMultiSig {
+		return false
+	}
+
+	m, n := ops[0].Opcode, ops[last-1].Opcode
+	if !isSmallInt(m) || !isSmallInt(n) || smallInt(m) < 1 || smallInt(m) > smallInt(n) {
+		return false
+	}
+
+	keys := ops[1 : last-1]
+	if len(keys) != smallInt(n) {
+		return false
+	}
+	for _, op := range keys {
+		if !isPubKeyPush(op) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isPushOnly reports whether the script only pushes data onto the stack.
+func (s Script) isPushOnly() bool {
+	ops, err := s.Ops()
+	if err != nil {
+		return false
+	}
+
+	for _, op := range ops {
+		if op.Opcode > Op16 {
+			return false
+		}
+	}
+	return true
+}
+
+// isPubKeyPush reports whether op pushes data of the size of a public key
+// with the given prefix.
+func isPubKeyPush(op Op) bool {
+	if !op.IsPush() || len(op.Data) == 0 {
+		return false
+	}
+
+	switch op.Data[0] {
+	case 0x02, 0x03:
+		return len(op.Data) == 33
+	case 0x04, 0x06, 0x07:
+		return len(op.Data) == 65
+	default:
+		return false
+	}
+}
+
+func isSmallInt(o Opcode) bool {
+	return o == OpFalse || (o >= OpTrue && o <= Op16)
+}
+
+// smallInt returns the number pushed by OpFalse or OpTrue to Op16.
+func smallInt(o Opcode) int {
+	if o == OpFalse {
+		return 0
+	}
+	return int(o-OpTrue) + 1
+}
@@ -0,0 +1,251 @@
+package ipldbtc
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+)
+
+// BlockStreamDecoder decodes block messages from an io.Reader without
+// holding the whole block in memory, handing out each node as soon as it is
+// available.
+type BlockStreamDecoder struct {
+	r    *reader
+	opts decodeOptions
+}
+
+// NewBlockStreamDecoder returns a decoder for the block messages in r. Of
+// opts, AddressNetwork and SkipMerkleCheck apply.
+func NewBlockStreamDecoder(r io.Reader, opts ...DecodeOption) *BlockStreamDecoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	d := &BlockStreamDecoder{r: newReader(br)}
+	for _, opt := range opts {
+		opt(&d.opts)
+	}
+	return d
+}
+
+// Decode reads the next block message from the stream and calls fn for each
+// node in it: first the Block, then every Tx in block order, each followed by
+// its Stripped form if it has witnesses. The TxTree nodes of the txid tree
+// and, for segwit blocks, of the witness tree are passed to fn as they are
+// completed, interleaved with the transactions, and the WitnessCommitment
+// follows the last transaction. The merkle root is passed last.
+//
+// Unless SkipMerkleCheck is given, once all transactions are read, the
+// merkle root is checked against the header as by DecodeBlockMessage; since the nodes have already been handed
+// out by then, callers should discard them if Decode returns an error.
+//
+// Decoding stops early if ctx is cancelled or fn returns an error, which is
+// then returned. Decode returns io.EOF if the stream holds no more blocks.
+// Decoding failures are reported as a *DecodeError with offsets relative to
+// the start of the stream.
+func (d *BlockStreamDecoder) Decode(ctx context.Context, fn func(node.Node) error) error {
+	if _, err := d.r.br.Peek(1); err == io.EOF {
+		return io.EOF
+	}
+
+	blk, err := readBlock(d.r)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(blk); err != nil {
+		return err
+	}
+
+	nTx, err := readVarint(d.r, "tx_count")
+	if err != nil {
+		return err
+	}
+
+	// the txid tree holds back its latest node, so that the merkle root is
+	// passed to fn after the witness tree and commitment
+	var held node.Node
+	txTree := &merkleBuilder{emit: func(n node.Node) error {
+		prev := held
+		held = n
+		if prev == nil {
+			return nil
+		}
+		return fn(prev)
+	}}
+	var witTree *merkleBuilder
+	var coinbase *Tx
+	for i := 0; i < nTx; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tx, err := readTxFrom(d.r)
+		if err != nil {
+			return withTxIndex(err, i)
+		}
+		tx.Network = d.opts.network
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		// the stripped form of a segwit transaction is a leaf of the txid
+		// tree, and is held back like its nodes in case it is the root
+		leaf := tx.Cid()
+		if tx.HasWitness() {
+			stripped := tx.Stripped()
+			if err := txTree.emit(stripped); err != nil {
+				return err
+			}
+			leaf = stripped.Cid()
+		}
+
+		if err := txTree.add(leaf); err != nil {
+			return err
+		}
+
+		if i == 0 {
+			coinbase = tx
+			if _, ok := tx.WitnessCommitment(); ok {
+				witTree = &merkleBuilder{emit: fn}
+				// the wtxid of the coinbase is defined to be all zeroes
+				err = witTree.add(hashToCid(make([]byte, 32), cid.BitcoinTx))
+			}
+		} else if witTree != nil {
+			err = witTree.add(hashToCid(tx.WitnessSha(), cid.BitcoinTx))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if witTree != nil {
+		root, err := witTree.finish()
+		if err != nil {
+			return err
+		}
+
+		wc, err := newWitnessCommitment(coinbase, root)
+		if err != nil && !d.opts.skipMerkleCheck {
+			return err
+		}
+
+		if wc != nil {
+			if err := fn(wc); err != nil {
+				return err
+			}
+		}
+	}
+
+	root, err := txTree.finish()
+	if err != nil {
+		return err
+	}
+
+	if held != nil {
+		if err := fn(held); err != nil {
+			return err
+		}
+	}
+
+	if d.opts.skipMerkleCheck {
+		return nil
+	}
+	return checkMerkleRoot(blk, root, txTree.mutated)
+}
+
+// merkleBuilder incrementally builds a bitcoin merkle tree, emitting each
+// TxTree node as soon as both of its children are known.
+type merkleBuilder struct {
+	emit func(node.Node) error
+
+	// pending holds, per height, a node still waiting for its right sibling
+	pending []cid.Cid
+	count   int
+
+	// mutated is set if two siblings were identical, see mkMerkleTree
+	mutated bool
+}
+
+func (m *merkleBuilder) pair(left, right cid.Cid) (cid.Cid, error) {
+	t := &TxTree{
+		Left:  &node.Link{Cid: left},
+		Right: &node.Link{Cid: right},
+	}
+	if err := m.emit(t); err != nil {
+		return cid.Undef, err
+	}
+	return t.Cid(), nil
+}
+
+func (m *merkleBuilder) add(c cid.Cid) error {
+	m.count++
+	for h := 0; ; h++ {
+		if h == len(m.pending) {
+			m.pending = append(m.pending, cid.Undef)
+		}
+
+		if !m.pending[h].Defined() {
+			m.pending[h] = c
+			return nil
+		}
+
+		if m.pending[h].Equals(c) {
+			m.mutated = true
+		}
+
+		var err error
+		c, err = m.pair(m.pending[h], c)
+		if err != nil {
+			return err
+		}
+		m.pending[h] = cid.Undef
+	}
+}
+
+// finish completes the tree, duplicating the last node of odd sized layers,
+// and returns its root.
+func (m *merkleBuilder) finish() (cid.Cid, error) {
+	if m.count == 0 {
+		return cid.Undef, nil
+	}
+
+	// carry is the rightmost node of the current height built from the
+	// layers below it
+	carry := cid.Undef
+	for h, p := range m.pending {
+		higher := false
+		for _, q := range m.pending[h+1:] {
+			if q.Defined() {
+				higher = true
+				break
+			}
+		}
+
+		var err error
+		switch {
+		case p.Defined() && carry.Defined():
+			carry, err = m.pair(p, carry)
+		case p.Defined():
+			if !higher {
+				return p, nil
+			}
+			carry, err = m.pair(p, p)
+		case carry.Defined():
+			if !higher {
+				return carry, nil
+			}
+			carry, err = m.pair(carry, carry)
+		}
+		if err != nil {
+			return cid.Undef, err
+		}
+	}
+
+	return carry, nil
+}
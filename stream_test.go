@@ -0,0 +1,163 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+)
+
+func TestBlockStreamDecoder(t *testing.T) {
+	var data []byte
+	var expected [][]node.Node
+	for _, fixture := range []string{"block.hex", "segwit.hex", "segwit3.hex"} {
+		b := loadFixture(t, fixture)
+		nodes, err := DecodeBlockMessage(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b...)
+		expected = append(expected, nodes)
+	}
+
+	dec := NewBlockStreamDecoder(bytes.NewReader(data))
+	for i, exp := range expected {
+		var got []node.Node
+		err := dec.Decode(context.Background(), func(n node.Node) error {
+			got = append(got, n)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("block %d: %s", i, err)
+		}
+
+		if len(got) != len(exp) {
+			t.Fatalf("block %d: expected %d nodes, got %d", i, len(exp), len(got))
+		}
+
+		want := make(map[cid.Cid]int)
+		for _, n := range exp {
+			want[n.Cid()]++
+		}
+		for _, n := range got {
+			want[n.Cid()]--
+		}
+		for c, count := range want {
+			if count != 0 {
+				t.Fatalf("block %d: node count mismatch for %s", i, c)
+			}
+		}
+
+		if !got[0].Cid().Equals(exp[0].Cid()) {
+			t.Fatalf("block %d: expected the header first", i)
+		}
+
+		if !got[len(got)-1].Cid().Equals(exp[0].(*Block).MerkleRoot) {
+			t.Fatalf("block %d: expected the merkle root last", i)
+		}
+	}
+
+	err := dec.Decode(context.Background(), func(node.Node) error { return nil })
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF at end of stream, got %v", err)
+	}
+}
+
+func TestBlockStreamDecoderSegwit(t *testing.T) {
+	blk, coinbase := singleTxSegwitBlock(t)
+
+	// a second block also spends the coinbase with a witness, committed to
+	// by its own coinbase
+	spend := &Tx{
+		Version:   2,
+		Inputs:    []*TxIn{{PrevTx: coinbase.Stripped().Cid(), SeqNo: 0xffffffff}},
+		Outputs:   []*TxOut{{Value: 4999990000, Script: []byte{0x51}}},
+		Witnesses: []*Witness{{Data: [][]byte{{0x51}}}},
+	}
+	cb := *coinbase
+	cb.Outputs = append([]*TxOut{}, coinbase.Outputs...)
+	_, wc, _ := mkWitnessTree([]*Tx{&cb, spend})
+	cb.Outputs[1] = &TxOut{Script: append(append([]byte{}, witnessCommitmentHeader...), cidToHash(wc.Cid())...)}
+	_, root, _ := mkMerkleTree([]cid.Cid{cb.Stripped().Cid(), spend.Stripped().Cid()})
+	blk2 := *blk
+	blk2.MerkleRoot = root
+
+	for i, txs := range [][]*Tx{{coinbase}, {&cb, spend}} {
+		b := blk
+		if len(txs) > 1 {
+			b = &blk2
+		}
+		data := encodeBlock(t, b, txs)
+		exp, err := DecodeBlockMessage(data)
+		if err != nil {
+			t.Fatalf("block %d: %s", i, err)
+		}
+
+		var got []node.Node
+		err = NewBlockStreamDecoder(bytes.NewReader(data)).Decode(context.Background(), func(n node.Node) error {
+			got = append(got, n)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("block %d: %s", i, err)
+		}
+
+		if len(got) != len(exp) {
+			t.Fatalf("block %d: expected %d nodes, got %d", i, len(exp), len(got))
+		}
+		want := make(map[cid.Cid]int)
+		for _, n := range exp {
+			want[n.Cid()]++
+		}
+		for _, n := range got {
+			want[n.Cid()]--
+		}
+		for c, count := range want {
+			if count != 0 {
+				t.Fatalf("block %d: node count mismatch for %s", i, c)
+			}
+		}
+
+		// with a single transaction, its stripped form is the merkle root
+		if last := got[len(got)-1]; !last.Cid().Equals(b.MerkleRoot) {
+			t.Fatalf("block %d: expected the merkle root last, got %s", i, last.Cid())
+		}
+	}
+}
+
+func TestBlockStreamDecoderCancel(t *testing.T) {
+	data := loadFixture(t, "segwit.hex")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var txs int
+	err := NewBlockStreamDecoder(bytes.NewReader(data)).Decode(ctx, func(n node.Node) error {
+		if _, ok := n.(*Tx); ok {
+			txs++
+			if txs == 10 {
+				cancel()
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	if txs != 10 {
+		t.Fatalf("expected decoding to stop after 10 transactions, got %d", txs)
+	}
+
+	stop := errors.New("stop")
+	err = NewBlockStreamDecoder(bytes.NewReader(data)).Decode(context.Background(), func(n node.Node) error {
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	// TapscriptLeafVersion is the leaf version of BIP342 tapscript.
+	TapscriptLeafVersion = 0xc0
+
+	// annexTag is the first byte of a taproot annex
+	annexTag = 0x50
+
+	// maxTaprootPathLen is the largest number of hashes in the merkle path
+	// of a control block.
+	maxTaprootPathLen = 128
+)
+
+// TaprootSpend is the interpretation of the witness of an input spending a
+// taproot output.
+type TaprootSpend struct {
+	// KeyPath is set for key path spends, which only carry Signature.
+	KeyPath   bool
+	Signature []byte
+
+	// Script, Stack and ControlBlock are set for script path spends: the
+	// leaf script executed, its initial stack and the proof that it is
+	// committed to by the output key.
+	Script       []byte
+	Stack        [][]byte
+	ControlBlock *ControlBlock
+
+	// Annex is the optional last witness item starting with 0x50, or nil.
+	Annex []byte
+}
+
+// ControlBlock is the last witness item of a taproot script path spend.
+type ControlBlock struct {
+	LeafVersion byte
+
+	// OutputKeyOddY is the parity of the y coordinate of the output key.
+	OutputKeyOddY bool
+
+	// InternalKey is the x-only internal public key.
+	InternalKey []byte
+
+	// MerklePath holds the hashes leading from the leaf to the root of the
+	// script tree.
+	MerklePath [][]byte
+}
+
+// Taproot interprets the witness as spending a taproot output, following
+// BIP341: an annex is split off, a single remaining item is a key path
+// signature and otherwise the last two items are the script and control
+// block of a script path spend.
+func (wit *Witness) Taproot() (*TaprootSpend, error) {
+	stack := wit.Data
+	if len(stack) == 0 {
+		return nil, fmt.Errorf("empty taproot witness")
+	}
+
+	spend := &TaprootSpend{}
+	if last := stack[len(stack)-1]; len(stack) >= 2 && len(last) > 0 && last[0] == annexTag {
+		spend.Annex = last
+		stack = stack[:len(stack)-1]
+	}
+
+	if len(stack) == 1 {
+		spend.KeyPath = true
+		spend.Signature = stack[0]
+		return spend, nil
+	}
+
+	cb, err := ParseControlBlock(stack[len(stack)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	spend.ControlBlock = cb
+	spend.Script = stack[len(stack)-2]
+	spend.Stack = stack[:len(stack)-2]
+	return spend, nil
+}
+
+// ParseControlBlock parses a taproot control block.
+func ParseControlBlock(b []byte) (*ControlBlock, error) {
+	if len(b) < 33 || (len(b)-33)%32 != 0 || (len(b)-33)/32 > maxTaprootPathLen {
+		return nil, fmt.Errorf("invalid control block length %d", len(b))
+	}
+
+	cb := &ControlBlock{
+		LeafVersion:   b[0] & 0xfe,
+		OutputKeyOddY: b[0]&1 == 1,
+		InternalKey:   b[1:33],
+	}
+	for i := 33; i < len(b); i += 32 {
+		cb.MerklePath = append(cb.MerklePath, b[i:i+32])
+	}
+
+	return cb, nil
+}
+
+// LeafHash returns the BIP341 tapleaf hash of script under the leaf version
+// of the control block.
+func (cb *ControlBlock) LeafHash(script []byte) []byte {
+	return TapLeafHash(cb.LeafVersion, script)
+}
+
+// MerkleRoot returns the root of the script tree proven by the control
+// block for the leaf with the given hash.
+func (cb *ControlBlock) MerkleRoot(leafHash []byte) []byte {
+	h := leafHash
+	for _, node := range cb.MerklePath {
+		h = TapBranchHash(h, node)
+	}
+	return h
+}
+
+// TapLeafHash returns the BIP341 hash of a script tree leaf.
+func TapLeafHash(leafVersion byte, script []byte) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(leafVersion)
+	writeVarInt(buf, uint64(len(script)))
+	buf.Write(script)
+	return taggedHash("TapLeaf", buf.Bytes())
+}
+
+// TapBranchHash returns the BIP341 hash of an inner node of a script tree,
+// ordering its children by hash.
+func TapBranchHash(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return taggedHash("TapBranch", append(append([]byte{}, a...), b...))
+}
+
+// TapTweakHash returns the BIP341 tweak applied to internalKey to get the
+// output key, for the script tree root merkleRoot or nil if there is none.
+func TapTweakHash(internalKey, merkleRoot []byte) []byte {
+	return taggedHash("TapTweak", append(append([]byte{}, internalKey...), merkleRoot...))
+}
+
+func taggedHash(tag string, msg []byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// SigHashTaproot returns the hash signed by a taproot key path signature of
+// input i, as defined by BIP341. prevOuts holds the outputs spent by every
+// input of the transaction, and annex the annex of the input if it has one.
+func (t *Tx) SigHashTaproot(i int, prevOuts []*TxOut, hashType SigHashType, annex []byte) ([]byte, error) {
+	return t.sigHashTaproot(i, prevOuts, hashType, annex, nil)
+}
+
+// SigHashTapscript returns the hash signed by a BIP342 tapscript signature
+// of input i, executing the leaf with the given tapleaf hash. codeSepPos is
+// the opcode position of the last executed OP_CODESEPARATOR, or 0xffffffff
+// if there was none.
+func (t *Tx) SigHashTapscript(i int, prevOuts []*TxOut, hashType SigHashType, annex []byte, leafHash []byte, codeSepPos uint32) ([]byte, error) {
+	ext := new(bytes.Buffer)
+	ext.Write(leafHash)
+	ext.WriteByte(0) // key_version
+	writeUint32(ext, codeSepPos)
+	return t.sigHashTaproot(i, prevOuts, hashType, annex, ext.Bytes())
+}
+
+func (t *Tx) sigHashTaproot(i int, prevOuts []*TxOut, hashType SigHashType, annex []byte, ext []byte) ([]byte, error) {
+	if i < 0 || i >= len(t.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", i)
+	}
+
+	if len(prevOuts) != len(t.Inputs) {
+		return nil, fmt.Errorf("got %d spent outputs for %d inputs", len(prevOuts), len(t.Inputs))
+	}
+
+	switch hashType {
+	case SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+		SigHashAll | SigHashAnyoneCanPay, SigHashNone | SigHashAnyoneCanPay, SigHashSingle | SigHashAnyoneCanPay:
+	default:
+		return nil, fmt.Errorf("invalid taproot hash type %#x", uint32(hashType))
+	}
+
+	base := hashType.base()
+	if base == SigHashSingle && i >= len(t.Outputs) {
+		return nil, fmt.Errorf("no output %d for SIGHASH_SINGLE", i)
+	}
+
+	msg := new(bytes.Buffer)
+	msg.WriteByte(0) // epoch
+	msg.WriteByte(byte(hashType))
+	writeUint32(msg, t.Version)
+	writeUint32(msg, t.LockTime)
+
+	if !hashType.anyoneCanPay() {
+		var prevouts, amounts, scripts, sequences bytes.Buffer
+		for j, inp := range t.Inputs {
+			writeOutpoint(&prevouts, inp)
+			writeUint64(&amounts, prevOuts[j].Value)
+			writeVarInt(&scripts, uint64(len(prevOuts[j].Script)))
+			scripts.Write(prevOuts[j].Script)
+			writeUint32(&sequences, inp.SeqNo)
+		}
+		msg.Write(sha256Sum(prevouts.Bytes()))
+		msg.Write(sha256Sum(amounts.Bytes()))
+		msg.Write(sha256Sum(scripts.Bytes()))
+		msg.Write(sha256Sum(sequences.Bytes()))
+	}
+
+	if base != SigHashNone && base != SigHashSingle {
+		var outputs bytes.Buffer
+		for _, out := range t.Outputs {
+			out.WriteTo(&outputs)
+		}
+		msg.Write(sha256Sum(outputs.Bytes()))
+	}
+
+	var spendType byte
+	if ext != nil {
+		spendType |= 2
+	}
+	if annex != nil {
+		spendType |= 1
+	}
+	msg.WriteByte(spendType)
+
+	if hashType.anyoneCanPay() {
+		inp := t.Inputs[i]
+		writeOutpoint(msg, inp)
+		writeUint64(msg, prevOuts[i].Value)
+		writeVarInt(msg, uint64(len(prevOuts[i].Script)))
+		msg.Write(prevOuts[i].Script)
+		writeUint32(msg, inp.SeqNo)
+	} else {
+		writeUint32(msg, uint32(i))
+	}
+
+	if annex != nil {
+		var a bytes.Buffer
+		writeVarInt(&a, uint64(len(annex)))
+		a.Write(annex)
+		msg.Write(sha256Sum(a.Bytes()))
+	}
+
+	if base == SigHashSingle {
+		var out bytes.Buffer
+		t.Outputs[i].WriteTo(&out)
+		msg.Write(sha256Sum(out.Bytes()))
+	}
+
+	msg.Write(ext)
+
+	return taggedHash("TapSighash", msg.Bytes()), nil
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,208 @@
+package ipldbtc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// fixtures/bip341_wallet_vectors.json holds the wallet test vectors of
+// BIP341.
+type bip341Vectors struct {
+	ScriptPubKey []struct {
+		Given struct {
+			InternalPubkey string          `json:"internalPubkey"`
+			ScriptTree     json.RawMessage `json:"scriptTree"`
+		} `json:"given"`
+		Intermediary struct {
+			LeafHashes []string `json:"leafHashes"`
+			MerkleRoot string   `json:"merkleRoot"`
+			Tweak      string   `json:"tweak"`
+		} `json:"intermediary"`
+		Expected struct {
+			ControlBlocks []string `json:"scriptPathControlBlocks"`
+		} `json:"expected"`
+	} `json:"scriptPubKey"`
+
+	KeyPathSpending []struct {
+		Given struct {
+			RawUnsignedTx string `json:"rawUnsignedTx"`
+			UtxosSpent    []struct {
+				ScriptPubKey string `json:"scriptPubKey"`
+				AmountSats   uint64 `json:"amountSats"`
+			} `json:"utxosSpent"`
+		} `json:"given"`
+		InputSpending []struct {
+			Given struct {
+				TxinIndex int         `json:"txinIndex"`
+				HashType  SigHashType `json:"hashType"`
+			} `json:"given"`
+			Intermediary struct {
+				SigHash string `json:"sigHash"`
+			} `json:"intermediary"`
+			Expected struct {
+				Witness []string `json:"witness"`
+			} `json:"expected"`
+		} `json:"inputSpending"`
+		Auxiliary struct {
+			FullySignedTx string `json:"fullySignedTx"`
+		} `json:"auxiliary"`
+	} `json:"keyPathSpending"`
+}
+
+func loadBIP341Vectors(t *testing.T) *bip341Vectors {
+	t.Helper()
+
+	data, err := os.ReadFile("fixtures/bip341_wallet_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v bip341Vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return &v
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSigHashTaproot(t *testing.T) {
+	v := loadBIP341Vectors(t)
+
+	for _, kp := range v.KeyPathSpending {
+		tx, err := DecodeTx(mustHex(t, kp.Given.RawUnsignedTx))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var prevOuts []*TxOut
+		for _, u := range kp.Given.UtxosSpent {
+			prevOuts = append(prevOuts, &TxOut{Value: u.AmountSats, Script: mustHex(t, u.ScriptPubKey)})
+		}
+
+		for _, in := range kp.InputSpending {
+			hash, err := tx.SigHashTaproot(in.Given.TxinIndex, prevOuts, in.Given.HashType, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := hex.EncodeToString(hash); got != in.Intermediary.SigHash {
+				t.Fatalf("input %d: expected %s, got %s", in.Given.TxinIndex, in.Intermediary.SigHash, got)
+			}
+
+			wit := &Witness{}
+			for _, item := range in.Expected.Witness {
+				wit.Data = append(wit.Data, mustHex(t, item))
+			}
+
+			spend, err := wit.Taproot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !spend.KeyPath || len(spend.Signature) != 64 && len(spend.Signature) != 65 {
+				t.Fatalf("input %d: expected a key path signature", in.Given.TxinIndex)
+			}
+		}
+
+		if _, err := tx.SigHashTaproot(0, prevOuts, 0x84, nil); err == nil {
+			t.Fatal("expected error for an invalid hash type")
+		}
+		if _, err := tx.SigHashTaproot(0, prevOuts[1:], SigHashAll, nil); err == nil {
+			t.Fatal("expected error for missing spent outputs")
+		}
+	}
+}
+
+// collectLeaves flattens a BIP341 vector script tree into its leaves by id.
+func collectLeaves(t *testing.T, tree json.RawMessage, leaves map[int][]byte) {
+	if len(tree) == 0 || string(tree) == "null" {
+		return
+	}
+
+	var branch []json.RawMessage
+	if err := json.Unmarshal(tree, &branch); err == nil {
+		for _, b := range branch {
+			collectLeaves(t, b, leaves)
+		}
+		return
+	}
+
+	var leaf struct {
+		ID          int    `json:"id"`
+		Script      string `json:"script"`
+		LeafVersion byte   `json:"leafVersion"`
+	}
+	if err := json.Unmarshal(tree, &leaf); err != nil {
+		t.Fatal(err)
+	}
+	leaves[leaf.ID] = append([]byte{leaf.LeafVersion}, mustHex(t, leaf.Script)...)
+}
+
+func TestTaprootScriptPath(t *testing.T) {
+	v := loadBIP341Vectors(t)
+
+	var checked int
+	for _, spk := range v.ScriptPubKey {
+		internal := mustHex(t, spk.Given.InternalPubkey)
+
+		var root []byte
+		if spk.Intermediary.MerkleRoot != "" {
+			root = mustHex(t, spk.Intermediary.MerkleRoot)
+		}
+		if got := hex.EncodeToString(TapTweakHash(internal, root)); got != spk.Intermediary.Tweak {
+			t.Fatalf("expected tweak %s, got %s", spk.Intermediary.Tweak, got)
+		}
+
+		leaves := make(map[int][]byte)
+		collectLeaves(t, spk.Given.ScriptTree, leaves)
+
+		for id, cbHex := range spk.Expected.ControlBlocks {
+			leaf := leaves[id]
+			script := leaf[1:]
+
+			// a script path witness with an input and an annex
+			wit := &Witness{Data: [][]byte{{1}, script, mustHex(t, cbHex), {annexTag, 2}}}
+			spend, err := wit.Taproot()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if spend.KeyPath || len(spend.Stack) != 1 || len(spend.Annex) != 2 || string(spend.Script) != string(script) {
+				t.Fatalf("leaf %d: witness interpreted incorrectly", id)
+			}
+
+			cb := spend.ControlBlock
+			if cb.LeafVersion != leaf[0] || hex.EncodeToString(cb.InternalKey) != spk.Given.InternalPubkey {
+				t.Fatalf("leaf %d: control block parsed incorrectly", id)
+			}
+
+			leafHash := cb.LeafHash(script)
+			if got := hex.EncodeToString(leafHash); got != spk.Intermediary.LeafHashes[id] {
+				t.Fatalf("leaf %d: expected leaf hash %s, got %s", id, spk.Intermediary.LeafHashes[id], got)
+			}
+
+			if got := hex.EncodeToString(cb.MerkleRoot(leafHash)); got != spk.Intermediary.MerkleRoot {
+				t.Fatalf("leaf %d: expected merkle root %s, got %s", id, spk.Intermediary.MerkleRoot, got)
+			}
+			checked++
+		}
+	}
+
+	if checked == 0 {
+		t.Fatal("no control blocks checked")
+	}
+
+	if _, err := ParseControlBlock(make([]byte, 34)); err == nil {
+		t.Fatal("expected error for a control block of invalid length")
+	}
+}
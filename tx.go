@@ -19,12 +19,45 @@ type Tx struct {
 	Outputs   []*TxOut   `json:"outputs"`
 	LockTime  uint32     `json:"locktime"`
 	Witnesses []*Witness `json:"witnesses"`
+
+	// Network is the network whose addresses the outputs/N/address paths
+	// resolve to. It is not part of the transaction data, and defaults to
+	// MainNet if nil.
+	Network *Network `json:"-"`
 }
 
 type Witness struct {
 	Data [][]byte `json:"data"`
 }
 
+func (wit *Witness) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	n, err := writeVarInt(w, uint64(len(wit.Data)))
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	for _, item := range wit.Data {
+		n, err = writeVarInt(w, uint64(len(item)))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+
+		n, err = w.Write(item)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Cid returns the CID of the transaction, the hash of its RawData. For a
+// transaction with witnesses this is derived from the wtxid, which the
+// witness merkle tree links to; the merkle tree and the inputs spending the
+// transaction link to the txid, the CID of Stripped.
 func (t *Tx) Cid() cid.Cid {
 	h, _ := mh.Sum(t.RawData(), mh.DBL_SHA2_256, -1)
 	return cid.NewCidV1(cid.BitcoinTx, h)
@@ -37,14 +70,73 @@ func (t *Tx) Links() []*node.Link {
 		lnk.Name = fmt.Sprintf("inputs/%d/prevTx", i)
 		out = append(out, lnk)
 	}
+
+	for i, output := range t.Outputs {
+		if c, ok := output.Script.DataCid(); ok {
+			out = append(out, &node.Link{Name: fmt.Sprintf("outputs/%d/data", i), Cid: c})
+		}
+	}
+
+	if c, ok := t.WitnessCommitment(); ok {
+		out = append(out, &node.Link{Name: "witnessCommitment", Cid: c})
+	}
 	return out
 }
 
+// HasWitness reports whether any input of the transaction carries witness
+// data, in which case it is serialized in the BIP144 witness format.
+func (t *Tx) HasWitness() bool {
+	for _, wit := range t.Witnesses {
+		if wit != nil && len(wit.Data) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RawData returns the full serialization of the transaction, including the
+// segwit marker, flag and witnesses if it has any. DecodeTx(b).RawData()
+// gives back b.
 func (t *Tx) RawData() []byte {
+	return t.WitnessData()
+}
+
+// Stripped returns the transaction without its witnesses. Its RawData is
+// StrippedData and its CID is derived from the txid, so it is the node the
+// merkle tree and the inputs spending the transaction link to. For a
+// transaction without witnesses it has the same data and CID as t.
+func (t *Tx) Stripped() *Tx {
+	return &Tx{
+		Version:  t.Version,
+		Inputs:   t.Inputs,
+		Outputs:  t.Outputs,
+		LockTime: t.LockTime,
+		Network:  t.Network,
+	}
+}
+
+// StrippedData returns the serialization of the transaction without witness
+// data, as hashed for its txid.
+func (t *Tx) StrippedData() []byte {
+	return t.serialize(false)
+}
+
+// WitnessData returns the serialization of the transaction hashed for its
+// wtxid. It is the same as RawData.
+func (t *Tx) WitnessData() []byte {
+	return t.serialize(t.HasWitness())
+}
+
+func (t *Tx) serialize(witness bool) []byte {
 	buf := new(bytes.Buffer)
 	i := make([]byte, 4)
 	binary.LittleEndian.PutUint32(i, t.Version)
 	buf.Write(i)
+	if witness {
+		// segwit marker and flag
+		buf.Write([]byte{0x00, 0x01})
+	}
+
 	writeVarInt(buf, uint64(len(t.Inputs)))
 	for _, inp := range t.Inputs {
 		inp.WriteTo(buf)
@@ -55,6 +147,19 @@ func (t *Tx) RawData() []byte {
 		out.WriteTo(buf)
 	}
 
+	if witness {
+		for n := range t.Inputs {
+			var wit *Witness
+			if n < len(t.Witnesses) {
+				wit = t.Witnesses[n]
+			}
+			if wit == nil {
+				wit = &Witness{}
+			}
+			wit.WriteTo(buf)
+		}
+	}
+
 	binary.LittleEndian.PutUint32(i, t.LockTime)
 	buf.Write(i)
 
@@ -68,11 +173,21 @@ func (t *Tx) Loggable() map[string]interface{} {
 }
 
 func (t *Tx) Resolve(path []string) (interface{}, []string, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("zero length path")
+	}
+
 	switch path[0] {
 	case "version":
 		return t.Version, path[1:], nil
 	case "lockTime":
 		return t.LockTime, path[1:], nil
+	case "witnessCommitment":
+		c, ok := t.WitnessCommitment()
+		if !ok {
+			return nil, nil, fmt.Errorf("no such link")
+		}
+		return &node.Link{Cid: c}, path[1:], nil
 	case "inputs":
 		if len(path) == 1 {
 			return t.Inputs, nil, nil
@@ -98,7 +213,7 @@ func (t *Tx) Resolve(path []string) (interface{}, []string, error) {
 		case "seqNo":
 			return inp.SeqNo, path[3:], nil
 		case "script":
-			return inp.Script, path[3:], nil
+			return inp.Script.resolve(path[3:])
 		default:
 			return nil, nil, fmt.Errorf("no such link")
 		}
@@ -124,24 +239,66 @@ func (t *Tx) Resolve(path []string) (interface{}, []string, error) {
 		switch path[2] {
 		case "value":
 			return outp.Value, path[3:], nil
+		case "type":
+			return outp.Script.Class().String(), path[3:], nil
+		case "address":
+			addr, err := outp.Script.Address(t.network())
+			if err != nil {
+				return nil, nil, err
+			}
+			return addr, path[3:], nil
 		case "script":
-			/*
-				if outp.Script[0] == 0x6a { // OP_RETURN
-					c, err := cid.Decode(string(outp.Script[1:]))
-					if err == nil {
-						return &node.Link{Cid: c}, path[3:], nil
-					}
-				}
-			*/
-			return outp.Script, path[3:], nil
+			return outp.Script.resolve(path[3:])
+		case "data":
+			c, ok := outp.Script.DataCid()
+			if !ok {
+				return nil, nil, fmt.Errorf("no such link")
+			}
+			return &node.Link{Cid: c}, path[3:], nil
 		default:
 			return nil, nil, fmt.Errorf("no such link")
 		}
+	case "witnesses":
+		if len(path) == 1 {
+			return t.Witnesses, nil, nil
+		}
+
+		index, err := strconv.Atoi(path[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if index >= len(t.Witnesses) || index < 0 || t.Witnesses[index] == nil {
+			return nil, nil, fmt.Errorf("index out of range")
+		}
+
+		wit := t.Witnesses[index]
+		if len(path) == 2 {
+			return wit.Data, nil, nil
+		}
+
+		item, err := strconv.Atoi(path[2])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if item >= len(wit.Data) || item < 0 {
+			return nil, nil, fmt.Errorf("index out of range")
+		}
+		return wit.Data[item], path[3:], nil
 	default:
 		return nil, nil, fmt.Errorf("no such link")
 	}
 }
 
+// network returns the network used to resolve addresses.
+func (t *Tx) network() *Network {
+	if t.Network != nil {
+		return t.Network
+	}
+	return MainNet
+}
+
 func (t *Tx) ResolveLink(path []string) (*node.Link, []string, error) {
 	i, rest, err := t.Resolve(path)
 	if err != nil {
@@ -156,12 +313,27 @@ func (t *Tx) ResolveLink(path []string) (*node.Link, []string, error) {
 	return lnk, rest, nil
 }
 
+// Size returns the size of the full serialization of the transaction,
+// witnesses included, as TotalSize does. The size of its Stripped form is
+// StrippedSize.
 func (t *Tx) Size() (uint64, error) {
 	return uint64(len(t.RawData())), nil
 }
 
+// Stat reports the size of the full serialization of the transaction, the
+// data stored under its CID, witnesses included. The transactions it spends
+// from are not part of it, so its cumulative size is its own size. NodeStat has no room for the weight,
+// virtual size or fee rate of the transaction; see Weight, VSize and
+// FeeRate.
 func (t *Tx) Stat() (*node.NodeStat, error) {
-	return &node.NodeStat{}, nil
+	size := len(t.RawData())
+	return &node.NodeStat{
+		Hash:           t.Cid().String(),
+		NumLinks:       len(t.Links()),
+		BlockSize:      size,
+		DataSize:       size,
+		CumulativeSize: size,
+	}, nil
 }
 
 func (t *Tx) Copy() node.Node {
@@ -174,55 +346,50 @@ func (t *Tx) String() string {
 }
 
 func (t *Tx) Tree(p string, depth int) []string {
-	if depth == 0 {
-		return nil
+	out := []string{"version", "lockTime", "inputs", "outputs"}
+	for i, inp := range t.Inputs {
+		prefix := fmt.Sprintf("inputs/%d", i)
+		out = append(out, prefix, prefix+"/prevTx", prefix+"/seqNo")
+		out = inp.Script.tree(out, prefix+"/script")
 	}
 
-	switch p {
-	case "inputs":
-		return t.treeInputs(nil, depth+1)
-	case "outputs":
-		return t.treeOutputs(nil, depth+1)
-	case "":
-		out := []string{"version", "timeLock", "inputs", "outputs"}
-		out = t.treeInputs(out, depth)
-		out = t.treeOutputs(out, depth)
-		return out
-	default:
-		return nil
-	}
-}
-
-func (t *Tx) treeInputs(out []string, depth int) []string {
-	if depth < 2 {
-		return out
-	}
-
-	for i := range t.Inputs {
-		inp := "inputs/" + fmt.Sprint(i)
-		out = append(out, inp)
-		if depth > 2 {
-			out = append(out, inp+"/prevTx", inp+"/seqNo", inp+"/script")
+	for i, outp := range t.Outputs {
+		prefix := fmt.Sprintf("outputs/%d", i)
+		out = append(out, prefix, prefix+"/value", prefix+"/type")
+		if _, err := outp.Script.Address(t.network()); err == nil {
+			out = append(out, prefix+"/address")
+		}
+		out = outp.Script.tree(out, prefix+"/script")
+		if _, ok := outp.Script.DataCid(); ok {
+			out = append(out, prefix+"/data")
 		}
 	}
-	return out
-}
 
-func (t *Tx) treeOutputs(out []string, depth int) []string {
-	if depth < 2 {
-		return out
+	if len(t.Witnesses) > 0 {
+		out = append(out, "witnesses")
+		for i, wit := range t.Witnesses {
+			if wit == nil {
+				continue
+			}
+
+			prefix := fmt.Sprintf("witnesses/%d", i)
+			out = append(out, prefix)
+			for j := range wit.Data {
+				out = append(out, fmt.Sprintf("%s/%d", prefix, j))
+			}
+		}
 	}
 
-	for i := range t.Outputs {
-		o := "outputs/" + fmt.Sprint(i)
-		out = append(out, o)
-		if depth > 2 {
-			out = append(out, o+"/script", o+"/value")
-		}
+	if _, ok := t.WitnessCommitment(); ok {
+		out = append(out, "witnessCommitment")
 	}
-	return out
+	return filterTree(out, p, depth)
 }
 
+// BTCSha returns the hash of RawData in internal byte order, the hash in
+// the CID of the transaction. It is the wtxid, which for a transaction
+// without witnesses is also the txid; the txid of a segwit transaction is
+// the BTCSha of its Stripped form.
 func (t *Tx) BTCSha() []byte {
 	mh, _ := mh.Sum(t.RawData(), mh.DBL_SHA2_256, -1)
 	return []byte(mh[2:])
@@ -232,6 +399,16 @@ func (t *Tx) HexHash() string {
 	return hex.EncodeToString(revString(t.BTCSha()))
 }
 
+// WitnessSha returns the wtxid of the transaction in internal byte order.
+func (t *Tx) WitnessSha() []byte {
+	mh, _ := mh.Sum(t.WitnessData(), mh.DBL_SHA2_256, -1)
+	return []byte(mh[2:])
+}
+
+func (t *Tx) WitnessHexHash() string {
+	return hex.EncodeToString(revString(t.WitnessSha()))
+}
+
 func txHashToLink(b []byte) *node.Link {
 	mhb, _ := mh.Encode(b, mh.DBL_SHA2_256)
 	c := cid.NewCidV1(cid.BitcoinTx, mhb)
@@ -241,7 +418,7 @@ func txHashToLink(b []byte) *node.Link {
 type TxIn struct {
 	PrevTx      cid.Cid `json:"txid,omitempty"`
 	PrevTxIndex uint32  `json:"vout"`
-	Script      []byte  `json:"script"`
+	Script      Script  `json:"script"`
 	SeqNo       uint32  `json:"sequence"`
 }
 
@@ -274,7 +451,7 @@ func (i *TxIn) WriteTo(w io.Writer) (int64, error) {
 
 type TxOut struct {
 	Value  uint64 `json:"value"`
-	Script []byte `json:"script"`
+	Script Script `json:"script"`
 }
 
 func (o *TxOut) WriteTo(w io.Writer) (int64, error) {
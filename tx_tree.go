@@ -86,8 +86,30 @@ func (t *TxTree) Size() (uint64, error) {
 	return uint64(len(t.RawData())), nil
 }
 
+// Stat reports the size of the node and, where the sizes of its links are
+// known, as for the nodes returned by DecodeBlockMessage, the cumulative
+// size of the subtree: the node itself and every node and transaction
+// below it.
 func (t *TxTree) Stat() (*node.NodeStat, error) {
-	return &node.NodeStat{}, nil
+	size := len(t.RawData())
+	return &node.NodeStat{
+		Hash:           t.Cid().String(),
+		NumLinks:       len(t.Links()),
+		BlockSize:      size,
+		DataSize:       size,
+		CumulativeSize: int(t.cumulativeSize()),
+	}, nil
+}
+
+// cumulativeSize adds the sizes of the links to that of the node, counting
+// the right child only once if it duplicates the left one, as at the end of
+// an odd sized layer.
+func (t *TxTree) cumulativeSize() uint64 {
+	size := uint64(len(t.RawData())) + t.Left.Size
+	if !t.Right.Cid.Equals(t.Left.Cid) {
+		size += t.Right.Size
+	}
+	return size
 }
 
 func (t *TxTree) String() string {
@@ -95,5 +117,5 @@ func (t *TxTree) String() string {
 }
 
 func (t *TxTree) Tree(p string, depth int) []string {
-	return []string{"0", "1"}
+	return filterTree([]string{"0", "1"}, p, depth)
 }
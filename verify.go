@@ -0,0 +1,614 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// VerifyFlags selects the rules applied when verifying an input. The flags
+// follow the SCRIPT_VERIFY flags of Bitcoin Core, and share their values.
+type VerifyFlags uint32
+
+const (
+	// VerifyP2SH evaluates the redeem script of P2SH outputs (BIP16).
+	VerifyP2SH VerifyFlags = 1 << 0
+
+	// VerifyStrictEncoding requires defined hash types and well formed
+	// public keys.
+	VerifyStrictEncoding VerifyFlags = 1 << 1
+
+	// VerifyDERSignatures requires strict DER encoded signatures (BIP66).
+	VerifyDERSignatures VerifyFlags = 1 << 2
+
+	// VerifyLowS requires the S value of signatures to be at most half the
+	// curve order.
+	VerifyLowS VerifyFlags = 1 << 3
+
+	// VerifyNullDummy requires the extra item popped by OP_CHECKMULTISIG to
+	// be empty (BIP147).
+	VerifyNullDummy VerifyFlags = 1 << 4
+
+	// VerifySigPushOnly requires signature scripts to only push data.
+	VerifySigPushOnly VerifyFlags = 1 << 5
+
+	// VerifyMinimalData requires pushes and numbers to be minimally
+	// encoded.
+	VerifyMinimalData VerifyFlags = 1 << 6
+
+	// VerifyDiscourageUpgradableNops fails scripts executing the NOPs
+	// reserved for soft forks.
+	VerifyDiscourageUpgradableNops VerifyFlags = 1 << 7
+
+	// VerifyCleanStack requires a single item to be left on the stack.
+	VerifyCleanStack VerifyFlags = 1 << 8
+
+	// VerifyCheckLockTimeVerify enables OP_CHECKLOCKTIMEVERIFY (BIP65).
+	VerifyCheckLockTimeVerify VerifyFlags = 1 << 9
+
+	// VerifyCheckSequenceVerify enables OP_CHECKSEQUENCEVERIFY (BIP112).
+	VerifyCheckSequenceVerify VerifyFlags = 1 << 10
+
+	// VerifyWitness evaluates segwit programs (BIP141).
+	VerifyWitness VerifyFlags = 1 << 11
+
+	// VerifyDiscourageUpgradableWitnessProgram fails spends of unknown
+	// witness versions.
+	VerifyDiscourageUpgradableWitnessProgram VerifyFlags = 1 << 12
+
+	// VerifyMinimalIf requires the argument of OP_IF and OP_NOTIF in segwit
+	// v0 scripts to be empty or 1.
+	VerifyMinimalIf VerifyFlags = 1 << 13
+
+	// VerifyNullFail requires failed signature checks to use empty
+	// signatures.
+	VerifyNullFail VerifyFlags = 1 << 14
+
+	// VerifyWitnessPubKeyType requires compressed public keys in segwit v0
+	// spends.
+	VerifyWitnessPubKeyType VerifyFlags = 1 << 15
+
+	// VerifyConstScriptCode fails legacy scripts using OP_CODESEPARATOR or
+	// containing the signatures they check.
+	VerifyConstScriptCode VerifyFlags = 1 << 16
+
+	// VerifyTaproot evaluates segwit v1 programs (BIP341 and BIP342).
+	VerifyTaproot VerifyFlags = 1 << 17
+
+	// VerifyDiscourageUpgradableTaprootVersion fails script path spends of
+	// unknown leaf versions.
+	VerifyDiscourageUpgradableTaprootVersion VerifyFlags = 1 << 18
+
+	// VerifyDiscourageOpSuccess fails tapscripts containing OP_SUCCESSx.
+	VerifyDiscourageOpSuccess VerifyFlags = 1 << 19
+
+	// VerifyDiscourageUpgradablePubKeyType fails tapscript signature checks
+	// with unknown public key types.
+	VerifyDiscourageUpgradablePubKeyType VerifyFlags = 1 << 20
+
+	// ConsensusVerifyFlags are the rules enforced by the network since the
+	// activation of taproot.
+	ConsensusVerifyFlags = VerifyP2SH | VerifyDERSignatures | VerifyNullDummy |
+		VerifyCheckLockTimeVerify | VerifyCheckSequenceVerify | VerifyWitness | VerifyTaproot
+
+	// StandardVerifyFlags adds the policy rules Bitcoin Core applies to
+	// transactions it relays.
+	StandardVerifyFlags = ConsensusVerifyFlags | VerifyStrictEncoding | VerifyMinimalData |
+		VerifyDiscourageUpgradableNops | VerifyCleanStack | VerifyMinimalIf | VerifyNullFail |
+		VerifyLowS | VerifyDiscourageUpgradableWitnessProgram | VerifyWitnessPubKeyType |
+		VerifyConstScriptCode | VerifyDiscourageUpgradableTaprootVersion |
+		VerifyDiscourageOpSuccess | VerifyDiscourageUpgradablePubKeyType
+)
+
+// VerifyInput checks that input i of the transaction validly spends
+// prevOut, executing its signature script, the output script and any
+// redeem or witness script under the given flags. Invalid spends return a
+// ScriptError.
+//
+// P2TR spends are verified if their signatures use SIGHASH_ANYONECANPAY,
+// which commits to prevOut alone, or if the transaction has a single input.
+// Other taproot signatures commit to every output spent by the transaction,
+// so VerifyInput returns ErrPrevOutsRequired for them and VerifyInputs must
+// be used instead.
+func (t *Tx) VerifyInput(i int, prevOut *TxOut, flags VerifyFlags) error {
+	if i < 0 || i >= len(t.Inputs) {
+		return fmt.Errorf("input index %d out of range", i)
+	}
+
+	prevOuts := make([]*TxOut, len(t.Inputs))
+	prevOuts[i] = prevOut
+	return t.verifyInput(i, prevOuts, flags)
+}
+
+// VerifyInputs checks every input of the transaction, where prevOuts holds
+// the output spent by each input in order. See VerifyInput.
+func (t *Tx) VerifyInputs(prevOuts []*TxOut, flags VerifyFlags) error {
+	if len(prevOuts) != len(t.Inputs) {
+		return fmt.Errorf("got %d spent outputs for %d inputs", len(prevOuts), len(t.Inputs))
+	}
+
+	for i := range t.Inputs {
+		if err := t.verifyInput(i, prevOuts, flags); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// verifyInput follows VerifyScript of Bitcoin Core.
+func (t *Tx) verifyInput(i int, prevOuts []*TxOut, flags VerifyFlags) error {
+	if prevOuts[i] == nil {
+		return fmt.Errorf("no spent output for input %d", i)
+	}
+
+	e := &engine{tx: t, index: i, prevOuts: prevOuts, flags: flags}
+	sigScript := t.Inputs[i].Script
+	pkScript := prevOuts[i].Script
+
+	var witness [][]byte
+	if i < len(t.Witnesses) && t.Witnesses[i] != nil {
+		witness = t.Witnesses[i].Data
+	}
+
+	if flags&VerifySigPushOnly != 0 && !sigScript.isPushOnly() {
+		return scriptError(ScriptErrSigPushOnly)
+	}
+
+	var stack scriptStack
+	if err := e.eval(&stack, sigScript, sigVersionBase); err != nil {
+		return err
+	}
+
+	// P2SH evaluates the redeem script on the stack left by the
+	// signature script
+	var p2shStack scriptStack
+	if flags&VerifyP2SH != 0 {
+		p2shStack = append(p2shStack, stack...)
+	}
+
+	if err := e.eval(&stack, pkScript, sigVersionBase); err != nil {
+		return err
+	}
+	if len(stack) == 0 || !castToBool(stack.top(-1)) {
+		return scriptError(ScriptErrEvalFalse)
+	}
+
+	hadWitness := false
+	if flags&VerifyWitness != 0 {
+		if version, program, ok := pkScript.WitnessProgram(); ok {
+			hadWitness = true
+			if len(sigScript) != 0 {
+				return scriptError(ScriptErrWitnessMalleated)
+			}
+			if err := e.verifyWitnessProgram(witness, version, program, false); err != nil {
+				return err
+			}
+			stack = stack[:1]
+		}
+	}
+
+	if flags&VerifyP2SH != 0 && pkScript.isScriptHash() {
+		if !sigScript.isPushOnly() {
+			return scriptError(ScriptErrSigPushOnly)
+		}
+
+		stack = p2shStack
+		redeem := Script(stack.pop())
+		if err := e.eval(&stack, redeem, sigVersionBase); err != nil {
+			return err
+		}
+		if len(stack) == 0 || !castToBool(stack.top(-1)) {
+			return scriptError(ScriptErrEvalFalse)
+		}
+
+		if flags&VerifyWitness != 0 {
+			if version, program, ok := redeem.WitnessProgram(); ok {
+				hadWitness = true
+				// the signature script must be the push of the redeem
+				// script alone, so that it cannot be malleated
+				if !bytes.Equal(sigScript, pushScript(redeem)) {
+					return scriptError(ScriptErrWitnessMalleatedP2SH)
+				}
+				if err := e.verifyWitnessProgram(witness, version, program, true); err != nil {
+					return err
+				}
+				stack = stack[:1]
+			}
+		}
+	}
+
+	if flags&VerifyCleanStack != 0 && len(stack) != 1 {
+		return scriptError(ScriptErrCleanStack)
+	}
+
+	if flags&VerifyWitness != 0 && !hadWitness && len(witness) != 0 {
+		return scriptError(ScriptErrWitnessUnexpected)
+	}
+
+	return nil
+}
+
+func (e *engine) verifyWitnessProgram(witness [][]byte, version int, program []byte, p2sh bool) error {
+	stack := append(scriptStack(nil), witness...)
+
+	switch {
+	case version == 0 && len(program) == 32:
+		if len(stack) == 0 {
+			return scriptError(ScriptErrWitnessProgramWitnessEmpty)
+		}
+		script := Script(stack.pop())
+		if sum := sha256.Sum256(script); !bytes.Equal(sum[:], program) {
+			return scriptError(ScriptErrWitnessProgramMismatch)
+		}
+		return e.executeWitnessScript(stack, script, sigVersionWitnessV0)
+
+	case version == 0 && len(program) == 20:
+		if len(stack) != 2 {
+			return scriptError(ScriptErrWitnessProgramMismatch)
+		}
+		script := pubKeyHashScript(program)
+		return e.executeWitnessScript(stack, script, sigVersionWitnessV0)
+
+	case version == 0:
+		return scriptError(ScriptErrWitnessProgramWrongLength)
+
+	case version == 1 && len(program) == 32 && !p2sh:
+		if e.flags&VerifyTaproot == 0 {
+			return nil
+		}
+		if len(stack) == 0 {
+			return scriptError(ScriptErrWitnessProgramWitnessEmpty)
+		}
+		if last := stack.top(-1); len(stack) >= 2 && len(last) > 0 && last[0] == annexTag {
+			e.annex = stack.pop()
+		}
+
+		if len(stack) == 1 {
+			return e.checkSchnorr(stack[0], program, sigVersionTaproot)
+		}
+
+		cb, err := ParseControlBlock(stack.pop())
+		if err != nil {
+			return scriptError(ScriptErrTaprootWrongControlSize)
+		}
+		script := Script(stack.pop())
+		e.tapLeafHash = cb.LeafHash(script)
+		if !verifyTaprootCommitment(cb, program, e.tapLeafHash) {
+			return scriptError(ScriptErrWitnessProgramMismatch)
+		}
+
+		if cb.LeafVersion == TapscriptLeafVersion {
+			size, _ := (&Witness{Data: witness}).WriteTo(io.Discard)
+			e.weightLeft = size + validationWeightOffset
+			return e.executeWitnessScript(stack, script, sigVersionTapscript)
+		}
+
+		// unknown leaf versions are left for future soft forks
+		if e.flags&VerifyDiscourageUpgradableTaprootVersion != 0 {
+			return scriptError(ScriptErrDiscourageUpgradableTaprootVersion)
+		}
+		return nil
+
+	default:
+		// unknown witness versions are left for future soft forks
+		if e.flags&VerifyDiscourageUpgradableWitnessProgram != 0 {
+			return scriptError(ScriptErrDiscourageUpgradableWitnessProgram)
+		}
+		return nil
+	}
+}
+
+func (e *engine) executeWitnessScript(stack scriptStack, script Script, sv sigVersion) error {
+	if sv == sigVersionTapscript {
+		// OP_SUCCESSx makes the script succeed before any other rule
+		for pc := 0; pc < len(script); {
+			op, n, err := script.opAt(pc)
+			if err != nil {
+				return scriptError(ScriptErrBadOpcode)
+			}
+			if isOpSuccess(op.Opcode) {
+				if e.flags&VerifyDiscourageOpSuccess != 0 {
+					return scriptError(ScriptErrDiscourageOpSuccess)
+				}
+				return nil
+			}
+			pc += n
+		}
+
+		if len(stack) > maxStackSize {
+			return scriptError(ScriptErrStackSize)
+		}
+	}
+
+	for _, item := range stack {
+		if len(item) > maxScriptElementSize {
+			return scriptError(ScriptErrPushSize)
+		}
+	}
+
+	if err := e.eval(&stack, script, sv); err != nil {
+		return err
+	}
+
+	// witness scripts must leave a single true item
+	if len(stack) != 1 {
+		return scriptError(ScriptErrCleanStack)
+	}
+	if !castToBool(stack[0]) {
+		return scriptError(ScriptErrEvalFalse)
+	}
+	return nil
+}
+
+// verifyTaprootCommitment checks that the output key program commits to
+// the script tree proven by the control block for the given leaf.
+func verifyTaprootCommitment(cb *ControlBlock, program, leafHash []byte) bool {
+	internal, err := schnorr.ParsePubKey(cb.InternalKey)
+	if err != nil {
+		return false
+	}
+
+	var tweak btcec.ModNScalar
+	if tweak.SetByteSlice(TapTweakHash(cb.InternalKey, cb.MerkleRoot(leafHash))) {
+		return false
+	}
+
+	var p, t, q btcec.JacobianPoint
+	internal.AsJacobian(&p)
+	btcec.ScalarBaseMultNonConst(&tweak, &t)
+	btcec.AddNonConst(&p, &t, &q)
+	q.ToAffine()
+
+	if q.X.IsZero() && q.Y.IsZero() {
+		return false
+	}
+	return bytes.Equal(q.X.Bytes()[:], program) && q.Y.IsOdd() == cb.OutputKeyOddY
+}
+
+// checkSignatureEncoding applies the encoding rules selected by the flags
+// to a signature with its hash type. Empty signatures are allowed as a
+// compact way to fail a check.
+func (e *engine) checkSignatureEncoding(sig []byte) error {
+	if len(sig) == 0 {
+		return nil
+	}
+
+	if e.flags&(VerifyDERSignatures|VerifyLowS|VerifyStrictEncoding) != 0 && !isValidSignatureEncoding(sig) {
+		return scriptError(ScriptErrSigDER)
+	}
+
+	if e.flags&VerifyLowS != 0 {
+		_, s, _ := parseDERLax(sig[:len(sig)-1])
+		if s.IsOverHalfOrder() {
+			return scriptError(ScriptErrSigHighS)
+		}
+	}
+
+	if e.flags&VerifyStrictEncoding != 0 {
+		if b := SigHashType(sig[len(sig)-1]) &^ SigHashAnyoneCanPay; b < SigHashAll || b > SigHashSingle {
+			return scriptError(ScriptErrSigHashType)
+		}
+	}
+	return nil
+}
+
+func (e *engine) checkPubKeyEncoding(pubKey []byte, sv sigVersion) error {
+	if e.flags&VerifyStrictEncoding != 0 && !isCompressedOrUncompressedPubKey(pubKey) {
+		return scriptError(ScriptErrPubKeyType)
+	}
+
+	if e.flags&VerifyWitnessPubKeyType != 0 && sv == sigVersionWitnessV0 && !btcec.IsCompressedPubKey(pubKey) {
+		return scriptError(ScriptErrWitnessPubKeyType)
+	}
+	return nil
+}
+
+func isCompressedOrUncompressedPubKey(pubKey []byte) bool {
+	if len(pubKey) < 33 {
+		return false
+	}
+
+	switch pubKey[0] {
+	case 0x04:
+		return len(pubKey) == 65
+	case 0x02, 0x03:
+		return len(pubKey) == 33
+	default:
+		return false
+	}
+}
+
+// isValidSignatureEncoding reports whether sig, followed by its hash type,
+// is a strict DER encoded signature as required by BIP66.
+func isValidSignatureEncoding(sig []byte) bool {
+	if len(sig) < 9 || len(sig) > 73 || sig[0] != 0x30 || int(sig[1]) != len(sig)-3 {
+		return false
+	}
+
+	lenR := int(sig[3])
+	if 5+lenR >= len(sig) {
+		return false
+	}
+	lenS := int(sig[5+lenR])
+	if lenR+lenS+7 != len(sig) {
+		return false
+	}
+
+	for _, n := range [][]byte{sig[2 : 4+lenR], sig[4+lenR : 6+lenR+lenS]} {
+		// an integer, positive and minimally encoded
+		if n[0] != 0x02 || n[1] == 0 || n[2]&0x80 != 0 {
+			return false
+		}
+		if n[1] > 1 && n[2] == 0 && n[3]&0x80 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDERLax parses a signature the way Bitcoin Core does for consensus,
+// accepting many BER encodings. Values that do not fit are returned as
+// zero, which fails verification; ok is false if the encoding is broken.
+func parseDERLax(sig []byte) (r, s btcec.ModNScalar, ok bool) {
+	pos := 0
+
+	// readLen reads a length byte, or a long form length
+	readLen := func(integer bool) (int, bool) {
+		if pos == len(sig) {
+			return 0, false
+		}
+		n := int(sig[pos])
+		pos++
+		if n&0x80 == 0 {
+			return n, true
+		}
+
+		n -= 0x80
+		if n > len(sig)-pos {
+			return 0, false
+		}
+		if !integer {
+			// the sequence length is ignored
+			pos += n
+			return 0, true
+		}
+
+		for n > 0 && sig[pos] == 0 {
+			pos++
+			n--
+		}
+		if n >= 4 {
+			return 0, false
+		}
+		l := 0
+		for ; n > 0; n-- {
+			l = l<<8 | int(sig[pos])
+			pos++
+		}
+		return l, true
+	}
+
+	if pos == len(sig) || sig[pos] != 0x30 {
+		return r, s, false
+	}
+	pos++
+	if _, ok := readLen(false); !ok {
+		return r, s, false
+	}
+
+	var ints [2][]byte
+	for i := range ints {
+		if pos == len(sig) || sig[pos] != 0x02 {
+			return r, s, false
+		}
+		pos++
+
+		l, ok := readLen(true)
+		if !ok || l > len(sig)-pos {
+			return r, s, false
+		}
+		ints[i] = bytes.TrimLeft(sig[pos:pos+l], "\x00")
+		pos += l
+	}
+
+	if len(ints[0]) > 32 || len(ints[1]) > 32 || r.SetByteSlice(ints[0]) || s.SetByteSlice(ints[1]) {
+		r.Zero()
+		s.Zero()
+	}
+	return r, s, true
+}
+
+// checkECDSA verifies a legacy or segwit v0 signature, followed by its hash
+// type, of the transaction with the given script code.
+func (e *engine) checkECDSA(sig, pubKey []byte, scriptCode Script, sv sigVersion) (bool, error) {
+	if len(sig) == 0 {
+		return false, nil
+	}
+
+	key, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return false, nil
+	}
+
+	r, s, ok := parseDERLax(sig[:len(sig)-1])
+	if !ok {
+		return false, nil
+	}
+	if s.IsOverHalfOrder() {
+		s.Negate()
+	}
+
+	hashType := SigHashType(sig[len(sig)-1])
+	var hash []byte
+	if sv == sigVersionWitnessV0 {
+		hash, err = e.tx.SigHashBIP143(e.index, scriptCode, e.prevOuts[e.index].Value, hashType)
+	} else {
+		hash, err = e.tx.SigHashLegacy(e.index, scriptCode, hashType)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return ecdsa.NewSignature(&r, &s).Verify(hash, key), nil
+}
+
+// checkSchnorr verifies a BIP340 signature, followed by its hash type if not
+// the default, by the x-only public key pubKey.
+func (e *engine) checkSchnorr(sig, pubKey []byte, sv sigVersion) error {
+	hashType := SigHashDefault
+	switch len(sig) {
+	case 64:
+	case 65:
+		hashType = SigHashType(sig[64])
+		if hashType == SigHashDefault {
+			return scriptError(ScriptErrSchnorrSigHashType)
+		}
+		sig = sig[:64]
+	default:
+		return scriptError(ScriptErrSchnorrSigSize)
+	}
+
+	// without SIGHASH_ANYONECANPAY the signature commits to every spent
+	// output
+	if !hashType.anyoneCanPay() {
+		for _, out := range e.prevOuts {
+			if out == nil {
+				return ErrPrevOutsRequired
+			}
+		}
+	}
+
+	var hash []byte
+	var err error
+	if sv == sigVersionTapscript {
+		hash, err = e.tx.SigHashTapscript(e.index, e.prevOuts, hashType, e.annex, e.tapLeafHash, e.codeSepPos)
+	} else {
+		hash, err = e.tx.SigHashTaproot(e.index, e.prevOuts, hashType, e.annex)
+	}
+	if err != nil {
+		return scriptError(ScriptErrSchnorrSigHashType)
+	}
+
+	key, err := schnorr.ParsePubKey(pubKey)
+	if err != nil {
+		return scriptError(ScriptErrSchnorrSig)
+	}
+	s, err := schnorr.ParseSignature(sig)
+	if err != nil || !s.Verify(hash, key) {
+		return scriptError(ScriptErrSchnorrSig)
+	}
+	return nil
+}
+
+func hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
@@ -0,0 +1,150 @@
+package ipldbtc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyInputsInBlocks(t *testing.T) {
+	for _, name := range []string{"block.hex", "segwit.hex", "segwit2.hex", "segwit3.hex"} {
+		nodes, err := DecodeBlockMessage(loadFixture(t, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txs := make(map[string]*Tx)
+		for _, tx := range blockTxs(nodes) {
+			txs[tx.Stripped().Cid().KeyString()] = tx
+		}
+
+		// only outputs created earlier in the same block are available
+		verified := 0
+		for _, tx := range blockTxs(nodes) {
+			for i, inp := range tx.Inputs {
+				if !inp.PrevTx.Defined() {
+					continue
+				}
+				prev, ok := txs[inp.PrevTx.KeyString()]
+				if !ok {
+					continue
+				}
+
+				if err := tx.VerifyInput(i, prev.Outputs[inp.PrevTxIndex], ConsensusVerifyFlags); err != nil {
+					t.Errorf("%s: tx %s input %d: %s", name, tx.HexHash(), i, err)
+				}
+				verified++
+			}
+		}
+
+		if verified == 0 {
+			t.Errorf("%s: no inputs verified", name)
+		}
+	}
+}
+
+func TestVerifyInputBIP143(t *testing.T) {
+	// native P2WPKH example of BIP143, also spending a P2PK output
+	tx, err := DecodeTx(mustHex(t, "01000000000102fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f00000000494830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac000247304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee0121025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee635711000000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevOuts := []*TxOut{
+		{Value: 625000000, Script: mustHex(t, "2103c9f4836b9a4f77fc0d81f7bcb01b7f1b35916864b9476c241ce9fc198bd25432ac")},
+		{Value: 600000000, Script: mustHex(t, "00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1")},
+	}
+
+	flags := ConsensusVerifyFlags | VerifyStrictEncoding | VerifyLowS | VerifyWitnessPubKeyType
+	if err := tx.VerifyInputs(prevOuts, flags); err != nil {
+		t.Fatal(err)
+	}
+
+	// the amount is committed to by segwit signatures only
+	if err := tx.VerifyInput(0, &TxOut{Value: 1, Script: prevOuts[0].Script}, flags); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.VerifyInput(1, &TxOut{Value: 1, Script: prevOuts[1].Script}, flags); !errors.Is(err, ErrScriptVerify) {
+		t.Fatalf("expected ErrScriptVerify for wrong amount, got %v", err)
+	}
+
+	// P2SH-P2WPKH example of BIP143
+	tx, err = DecodeTx(mustHex(t, "01000000000101db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a5477010000001716001479091972186c449eb1ded22b78e40d009bdf0089feffffff02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac02473044022047ac8e878352d3ebbde1c94ce3a10d057c24175747116f8288e5d794d12d482f0220217f36a485cae903c713331d877c1f64677e3622ad4010726870540656fe9dcb012103ad1d8e89212f0b92c74d23bb710c00662ad1470198ac48c43f7d6f93a2a2687392040000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevOut := &TxOut{Value: 1000000000, Script: mustHex(t, "a9144733f37cf4db86fbc2efed2500b4f4e49f31202387")}
+	if err := tx.VerifyInput(0, prevOut, flags); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.Outputs[0].Value++
+	if err := tx.VerifyInput(0, prevOut, flags); !errors.Is(err, ErrScriptVerify) {
+		t.Fatalf("expected ErrScriptVerify for modified output, got %v", err)
+	}
+}
+
+func TestVerifyInputTaprootKeyPath(t *testing.T) {
+	v := loadBIP341Vectors(t)
+
+	for _, kp := range v.KeyPathSpending {
+		tx, err := DecodeTx(mustHex(t, kp.Auxiliary.FullySignedTx))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		prevOuts := make([]*TxOut, len(kp.Given.UtxosSpent))
+		for i, u := range kp.Given.UtxosSpent {
+			prevOuts[i] = &TxOut{Value: u.AmountSats, Script: mustHex(t, u.ScriptPubKey)}
+		}
+
+		// only the taproot inputs are signed
+		for _, in := range kp.InputSpending {
+			i := in.Given.TxinIndex
+			if err := tx.verifyInput(i, prevOuts, ConsensusVerifyFlags); err != nil {
+				t.Fatalf("input %d: %s", i, err)
+			}
+
+			// SIGHASH_ANYONECANPAY signatures only commit to the output
+			// spent by the input
+			err := tx.VerifyInput(i, prevOuts[i], ConsensusVerifyFlags)
+			if in.Given.HashType.anyoneCanPay() && err != nil {
+				t.Fatalf("input %d: %s", i, err)
+			}
+			if !in.Given.HashType.anyoneCanPay() && !errors.Is(err, ErrPrevOutsRequired) {
+				t.Fatalf("input %d: expected ErrPrevOutsRequired, got %v", i, err)
+			}
+		}
+
+		tx.LockTime++
+		for _, in := range kp.InputSpending {
+			i := in.Given.TxinIndex
+			if err := tx.verifyInput(i, prevOuts, ConsensusVerifyFlags); !errors.Is(err, ErrScriptVerify) {
+				t.Fatalf("input %d: expected ErrScriptVerify for modified tx, got %v", i, err)
+			}
+		}
+	}
+}
+
+func TestSignatureEncoding(t *testing.T) {
+	valid := mustHex(t, "3045022100fbefd94bd0a488d50b79102b5dad4ab6ced30c4069f1eaa69a4b5a763414067e02203156c6a5c9cf88f91265f5a942e96213afae16d83321c8b31bb342142a14d16301")
+	if !isValidSignatureEncoding(valid) {
+		t.Fatal("expected a strict DER signature")
+	}
+	if _, s, ok := parseDERLax(valid[:len(valid)-1]); !ok || s.IsOverHalfOrder() {
+		t.Fatal("expected a low S signature")
+	}
+
+	for _, sig := range []string{
+		// R with a needless leading zero
+		"304602220000fbefd94bd0a488d50b79102b5dad4ab6ced30c4069f1eaa69a4b5a763414067e02203156c6a5c9cf88f91265f5a942e96213afae16d83321c8b31bb342142a14d16301",
+		// negative S
+		"3045022100fbefd94bd0a488d50b79102b5dad4ab6ced30c4069f1eaa69a4b5a763414067e0220b156c6a5c9cf88f91265f5a942e96213afae16d83321c8b31bb342142a14d16301",
+		// wrong total length
+		"3046022100fbefd94bd0a488d50b79102b5dad4ab6ced30c4069f1eaa69a4b5a763414067e02203156c6a5c9cf88f91265f5a942e96213afae16d83321c8b31bb342142a14d16301",
+	} {
+		if isValidSignatureEncoding(mustHex(t, sig)) {
+			t.Errorf("expected %s to be rejected", sig)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ipldbtc
+
+import (
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// witnessScaleFactor is the weight of a non-witness byte, as defined by
+// BIP141.
+const witnessScaleFactor = 4
+
+// StrippedSize returns the size of the transaction serialized without
+// witness data.
+func (t *Tx) StrippedSize() int64 {
+	return int64(len(t.StrippedData()))
+}
+
+// TotalSize returns the size of the full serialization of the transaction,
+// including witness data.
+func (t *Tx) TotalSize() int64 {
+	return int64(len(t.WitnessData()))
+}
+
+// Weight returns the BIP141 weight of the transaction: its stripped size
+// times three plus its total size.
+func (t *Tx) Weight() int64 {
+	return t.StrippedSize()*(witnessScaleFactor-1) + t.TotalSize()
+}
+
+// VSize returns the BIP141 virtual size of the transaction, its weight
+// divided by four, rounded up.
+func (t *Tx) VSize() int64 {
+	return (t.Weight() + witnessScaleFactor - 1) / witnessScaleFactor
+}
+
+// Fee returns the amount of the outputs spent by the transaction that it
+// does not pay to its own outputs. prevOuts holds the spent outputs in the
+// order of the inputs. It fails if one of them is missing or the outputs
+// pay more than the inputs.
+func (t *Tx) Fee(prevOuts []*TxOut) (uint64, error) {
+	if len(prevOuts) != len(t.Inputs) {
+		return 0, fmt.Errorf("%d spent outputs for %d inputs", len(prevOuts), len(t.Inputs))
+	}
+
+	var in, out uint64
+	for i, prevOut := range prevOuts {
+		if prevOut == nil {
+			return 0, fmt.Errorf("no spent output for input %d", i)
+		}
+		in += prevOut.Value
+	}
+	for _, o := range t.Outputs {
+		out += o.Value
+	}
+
+	if out > in {
+		return 0, fmt.Errorf("outputs pay %d satoshis, more than the %d spent", out, in)
+	}
+	return in - out, nil
+}
+
+// FeeRate returns the fee of the transaction in satoshis per virtual byte.
+func (t *Tx) FeeRate(prevOuts []*TxOut) (float64, error) {
+	fee, err := t.Fee(prevOuts)
+	if err != nil {
+		return 0, err
+	}
+	return float64(fee) / float64(t.VSize()), nil
+}
+
+// blockPrefixSize returns the size of the header and transaction count
+// that precede the transactions of a block.
+func blockPrefixSize(txs []*Tx) int64 {
+	n, _ := writeVarInt(io.Discard, uint64(len(txs)))
+	return 80 + int64(n)
+}
+
+// StrippedSize returns the size of the block serialized without witness
+// data.
+func (fb *FullBlock) StrippedSize() int64 {
+	size := blockPrefixSize(fb.Transactions)
+	for _, tx := range fb.Transactions {
+		size += tx.StrippedSize()
+	}
+	return size
+}
+
+// TotalSize returns the size of the block serialized with its witness
+// data.
+func (fb *FullBlock) TotalSize() int64 {
+	size := blockPrefixSize(fb.Transactions)
+	for _, tx := range fb.Transactions {
+		size += tx.TotalSize()
+	}
+	return size
+}
+
+// Weight returns the BIP141 weight of the block holding txs, which is
+// limited to 4,000,000 by consensus. The header only commits to the
+// transactions, so they are given and checked against its merkle root; a
+// FullBlock holds them already.
+func (b *Block) Weight(txs []*Tx) (int64, error) {
+	leaves := make([]cid.Cid, len(txs))
+	for i, tx := range txs {
+		leaves[i] = tx.Stripped().Cid()
+	}
+	_, root, mutated := mkMerkleTree(leaves)
+	if err := checkMerkleRoot(b, root, mutated); err != nil {
+		return 0, err
+	}
+	return (&FullBlock{Block: b, Transactions: txs}).Weight(), nil
+}
+
+// Weight returns the BIP141 weight of the block, which is limited to
+// 4,000,000 by consensus.
+func (fb *FullBlock) Weight() int64 {
+	weight := blockPrefixSize(fb.Transactions) * witnessScaleFactor
+	for _, tx := range fb.Transactions {
+		weight += tx.Weight()
+	}
+	return weight
+}
@@ -0,0 +1,105 @@
+package ipldbtc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTxWeight(t *testing.T) {
+	// the native P2WPKH example of BIP143
+	tx, err := DecodeTx(mustHex(t, "01000000000102fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f00000000494830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac000247304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee0121025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee635711000000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.StrippedSize() != 233 || tx.TotalSize() != 343 {
+		t.Fatalf("unexpected sizes %d, %d", tx.StrippedSize(), tx.TotalSize())
+	}
+	if tx.Weight() != 1042 || tx.VSize() != 261 {
+		t.Fatalf("unexpected weight %d, vsize %d", tx.Weight(), tx.VSize())
+	}
+
+	// the Tx node stores all of the transaction, its Stripped form the data
+	// hashed for the txid
+	st, err := tx.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sst, err := tx.Stripped().Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(st.BlockSize) != tx.TotalSize() || int64(sst.BlockSize) != tx.StrippedSize() {
+		t.Fatalf("unexpected stat %s, stripped stat %s", st, sst)
+	}
+	if size, _ := tx.Size(); int64(size) != tx.TotalSize() {
+		t.Fatalf("expected size %d, got %d", tx.TotalSize(), size)
+	}
+
+	prevOuts := []*TxOut{
+		{Value: 625000000, Script: mustHex(t, "2103c9f4836b9a4f77fc0d81f7bcb01b7f1b35916864b9476c241ce9fc198bd25432ac")},
+		{Value: 600000000, Script: mustHex(t, "00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1")},
+	}
+	fee, err := tx.Fee(prevOuts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee != 889210000 {
+		t.Fatalf("unexpected fee %d", fee)
+	}
+	rate, err := tx.FeeRate(prevOuts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 889210000.0/261 {
+		t.Fatalf("unexpected fee rate %f", rate)
+	}
+
+	if _, err := tx.Fee(prevOuts[:1]); err == nil {
+		t.Fatal("expected an error for a missing spent output")
+	}
+	if _, err := tx.Fee([]*TxOut{{Value: 1}, {Value: 1}}); err == nil {
+		t.Fatal("expected an error for outputs paying more than the inputs")
+	}
+
+	// without witnesses every byte weighs four units
+	tx.Witnesses = nil
+	if tx.Weight() != 4*233 || tx.VSize() != 233 {
+		t.Fatalf("unexpected weight %d, vsize %d", tx.Weight(), tx.VSize())
+	}
+}
+
+func TestBlockWeight(t *testing.T) {
+	for _, name := range []string{"block.hex", "segwit.hex", "segwit2.hex", "segwit3.hex"} {
+		data := loadFixture(t, name)
+		nodes, err := DecodeBlockMessage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fb := NewFullBlock(nodes[0].(*Block), blockTxs(nodes))
+
+		if fb.TotalSize() != int64(len(data)) {
+			t.Fatalf("%s: expected size %d, got %d", name, len(data), fb.TotalSize())
+		}
+
+		weight := fb.Weight()
+		if weight != 3*fb.StrippedSize()+fb.TotalSize() {
+			t.Fatalf("%s: weight %d does not match the sizes", name, weight)
+		}
+		if weight > 4000000 {
+			t.Fatalf("%s: weight %d over the consensus limit", name, weight)
+		}
+		if name != "block.hex" && fb.StrippedSize() == fb.TotalSize() {
+			t.Fatalf("%s: expected witness data", name)
+		}
+
+		txs := blockTxs(nodes)
+		if w, err := nodes[0].(*Block).Weight(txs); err != nil || w != weight {
+			t.Fatalf("%s: expected block weight %d, got %d (%v)", name, weight, w, err)
+		}
+		if _, err := nodes[0].(*Block).Weight(txs[1:]); !errors.Is(err, ErrMerkleRootMismatch) {
+			t.Fatalf("%s: expected the transactions of another block to fail, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package ipldbtc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	node "github.com/ipfs/go-ipld-format"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// BitcoinWitnessCommitment is the multicodec code for bitcoin witness
+// commitments.
+const BitcoinWitnessCommitment = 0xb2
+
+// witnessCommitmentHeader prefixes the witness commitment output script of a
+// segwit coinbase: OP_RETURN, a 36 byte push and the 0xaa21a9ed tag.
+var witnessCommitmentHeader = []byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+// WitnessCommitment is the data committed to by the coinbase transaction of
+// a segwit block: the root of the merkle tree of wtxids and the witness
+// reserved value held by the coinbase witness. Its double-sha256 hash is the
+// commitment found in the coinbase outputs.
+type WitnessCommitment struct {
+	WitnessMerkleRoot *node.Link
+	Nonce             []byte
+}
+
+// assert that WitnessCommitment matches the Node interface for ipld
+var _ node.Node = (*WitnessCommitment)(nil)
+
+func (wc *WitnessCommitment) Cid() cid.Cid {
+	h, _ := mh.Sum(wc.RawData(), mh.DBL_SHA2_256, -1)
+	return cid.NewCidV1(BitcoinWitnessCommitment, h)
+}
+
+func (wc *WitnessCommitment) RawData() []byte {
+	out := make([]byte, 64)
+	copy(out[:32], cidToHash(wc.WitnessMerkleRoot.Cid))
+	copy(out[32:], wc.Nonce)
+	return out
+}
+
+func (wc *WitnessCommitment) Links() []*node.Link {
+	return []*node.Link{
+		{
+			Name: "witnessMerkleRoot",
+			Cid:  wc.WitnessMerkleRoot.Cid,
+		},
+	}
+}
+
+func (wc *WitnessCommitment) Loggable() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "bitcoin_witness_commitment",
+	}
+}
+
+func (wc *WitnessCommitment) Resolve(path []string) (interface{}, []string, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("zero length path")
+	}
+
+	switch path[0] {
+	case "witnessMerkleRoot":
+		return wc.WitnessMerkleRoot, path[1:], nil
+	case "nonce":
+		return wc.Nonce, path[1:], nil
+	default:
+		return nil, nil, fmt.Errorf("no such link")
+	}
+}
+
+func (wc *WitnessCommitment) ResolveLink(path []string) (*node.Link, []string, error) {
+	out, rest, err := wc.Resolve(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lnk, ok := out.(*node.Link)
+	if !ok {
+		return nil, nil, fmt.Errorf("object at path was not a link")
+	}
+
+	return lnk, rest, nil
+}
+
+func (wc *WitnessCommitment) Copy() node.Node {
+	nwc := *wc
+	return &nwc
+}
+
+func (wc *WitnessCommitment) Size() (uint64, error) {
+	return uint64(len(wc.RawData())), nil
+}
+
+func (wc *WitnessCommitment) Stat() (*node.NodeStat, error) {
+	size := len(wc.RawData())
+	return &node.NodeStat{
+		Hash:           wc.Cid().String(),
+		NumLinks:       len(wc.Links()),
+		BlockSize:      size,
+		DataSize:       size,
+		CumulativeSize: size,
+	}, nil
+}
+
+func (wc *WitnessCommitment) String() string {
+	return "[bitcoin witness commitment]"
+}
+
+func (wc *WitnessCommitment) Tree(p string, depth int) []string {
+	return filterTree([]string{"witnessMerkleRoot", "nonce"}, p, depth)
+}
+
+func (wc *WitnessCommitment) HexHash() string {
+	return hex.EncodeToString(revString(cidToHash(wc.Cid())))
+}
+
+func DecodeWitnessCommitment(b []byte) (*WitnessCommitment, error) {
+	if len(b) != 64 {
+		return nil, fmt.Errorf("invalid witness commitment data")
+	}
+
+	return &WitnessCommitment{
+		WitnessMerkleRoot: txHashToLink(b[:32]),
+		Nonce:             append([]byte(nil), b[32:]...),
+	}, nil
+}
+
+// IsCoinbase reports whether the transaction is a coinbase, spending a
+// single null outpoint.
+func (t *Tx) IsCoinbase() bool {
+	if len(t.Inputs) != 1 {
+		return false
+	}
+
+	inp := t.Inputs[0]
+	return inp.PrevTxIndex == 0xffffffff && bytes.Equal(cidToHash(inp.PrevTx), make([]byte, 32))
+}
+
+// WitnessCommitment returns the CID of the witness commitment of a segwit
+// coinbase transaction. As in Bitcoin Core, the last output carrying a
+// commitment wins.
+func (t *Tx) WitnessCommitment() (cid.Cid, bool) {
+	if !t.IsCoinbase() {
+		return cid.Undef, false
+	}
+
+	for i := len(t.Outputs) - 1; i >= 0; i-- {
+		script := t.Outputs[i].Script
+		if len(script) >= 38 && bytes.HasPrefix(script, witnessCommitmentHeader) {
+			return hashToCid(script[6:38], BitcoinWitnessCommitment), true
+		}
+	}
+	return cid.Undef, false
+}
+
+// mkWitnessTree builds the merkle tree of wtxids for the given transactions
+// and the witness commitment over its root. It returns a nil commitment if
+// the coinbase does not commit to witness data. If the commitment does not
+// match, the tree and, where it can be built, the computed commitment are
+// returned along with the error.
+func mkWitnessTree(txs []*Tx) ([]*TxTree, *WitnessCommitment, error) {
+	leaves := witnessLeaves(txs)
+	if leaves == nil {
+		return nil, nil, nil
+	}
+
+	// as in Bitcoin Core, mutation of the witness tree is not checked here
+	// since the txid tree already rules out duplicated transactions
+	trees, root, _ := mkMerkleTree(leaves)
+	wc, err := newWitnessCommitment(txs[0], root)
+	return trees, wc, err
+}
+
+// witnessLeaves returns the leaves of the witness merkle tree of txs, or
+// nil if the coinbase does not commit to witness data.
+func witnessLeaves(txs []*Tx) []cid.Cid {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	if _, ok := txs[0].WitnessCommitment(); !ok {
+		return nil
+	}
+
+	// the wtxid of the coinbase is defined to be all zeroes
+	leaves := make([]cid.Cid, len(txs))
+	leaves[0] = hashToCid(make([]byte, 32), cid.BitcoinTx)
+	for i, tx := range txs[1:] {
+		leaves[i+1] = hashToCid(tx.WitnessSha(), cid.BitcoinTx)
+	}
+	return leaves
+}
+
+// newWitnessCommitment builds the witness commitment for the given wtxid
+// merkle root and checks it against the one committed to by coinbase. On a
+// mismatch the computed commitment is returned with the error.
+func newWitnessCommitment(coinbase *Tx, root cid.Cid) (*WitnessCommitment, error) {
+	expected, ok := coinbase.WitnessCommitment()
+	if !ok {
+		return nil, fmt.Errorf("coinbase has no witness commitment")
+	}
+
+	if len(coinbase.Witnesses) == 0 || len(coinbase.Witnesses[0].Data) != 1 || len(coinbase.Witnesses[0].Data[0]) != 32 {
+		return nil, fmt.Errorf("coinbase witness reserved value missing or invalid")
+	}
+
+	wc := &WitnessCommitment{
+		WitnessMerkleRoot: &node.Link{Cid: root},
+		Nonce:             coinbase.Witnesses[0].Data[0],
+	}
+
+	if !wc.Cid().Equals(expected) {
+		return wc, fmt.Errorf("witness commitment mismatch: computed %s, coinbase commits to %s", wc.Cid(), expected)
+	}
+
+	return wc, nil
+}